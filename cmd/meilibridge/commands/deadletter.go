@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/bridge"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func BuildDeadLetter(log logger.Logger) *cobra.Command {
+	dl := &cobra.Command{
+		Use:   "dead-letter",
+		Short: "manage failed trigger items",
+		Long: "manage failed trigger items of bridge storage, storage is locked by running bridge, " +
+			"so trigger sync must be stopped before these commands.",
+	}
+
+	dl.AddCommand(buildDeadLetterList(log))
+	dl.AddCommand(buildDeadLetterInspect())
+	dl.AddCommand(buildDeadLetterReplay(log))
+
+	return dl
+}
+
+func buildDeadLetterList(log logger.Logger) *cobra.Command {
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list dead letters of bridge",
+	}
+
+	cfgPath := configFlag(list)
+	name := bridgeFlag(list)
+
+	list.RunE = func(cmd *cobra.Command, args []string) error {
+		st, err := openBridgeStore(*cfgPath, *name)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+
+		letters, err := bridge.ListDeadLetters(st)
+		if err != nil {
+			return err
+		}
+
+		if len(letters) == 0 {
+			log.Info("there is no dead letter", "bridge", *name)
+			return nil
+		}
+
+		for _, l := range letters {
+			fmt.Printf("%s\t%s\t%s\t%v\t%d\t%s\n",
+				l.ID,
+				l.FailedAt.Format("2006-01-02 15:04:05"),
+				l.Item.IndexUID,
+				l.Item.Type,
+				l.Attempts,
+				l.Error,
+			)
+		}
+
+		return nil
+	}
+
+	return list
+}
+
+func buildDeadLetterInspect() *cobra.Command {
+	inspect := &cobra.Command{
+		Use:   "inspect [id]",
+		Short: "show dead letter item",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cfgPath := configFlag(inspect)
+	name := bridgeFlag(inspect)
+
+	inspect.RunE = func(cmd *cobra.Command, args []string) error {
+		st, err := openBridgeStore(*cfgPath, *name)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+
+		l, err := bridge.GetDeadLetter(st, args[0])
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l)
+	}
+
+	return inspect
+}
+
+func buildDeadLetterReplay(log logger.Logger) *cobra.Command {
+	replay := &cobra.Command{
+		Use:   "replay [id...]",
+		Short: "move dead letters back to trigger queue, they're processed by trigger sync",
+	}
+
+	cfgPath := configFlag(replay)
+	name := bridgeFlag(replay)
+	all := replay.Flags().Bool("all", false, "replay all dead letters")
+
+	replay.RunE = func(cmd *cobra.Command, args []string) error {
+		st, err := openBridgeStore(*cfgPath, *name)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+
+		ids := args
+		if *all {
+			letters, err := bridge.ListDeadLetters(st)
+			if err != nil {
+				return err
+			}
+
+			ids = make([]string, 0, len(letters))
+			for _, l := range letters {
+				ids = append(ids, l.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			return fmt.Errorf("dead letter id or --all is required")
+		}
+
+		for _, id := range ids {
+			if err := bridge.ReplayDeadLetter(st, id); err != nil {
+				return err
+			}
+			log.Info("replayed dead letter", "bridge", *name, "id", id)
+		}
+
+		return nil
+	}
+
+	return replay
+}
+
+func bridgeFlag(cmd *cobra.Command) *string {
+	return cmd.Flags().StringP("bridge", "b", "", "name of bridge")
+}
+
+// openBridgeStore opens storage of bridge, trigger sync must be stopped because
+// storage is locked by running process.
+func openBridgeStore(cfgPath, name string) (store.Store, error) {
+	cfg, err := config.New(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range cfg.Bridges {
+		if b.Name != name {
+			continue
+		}
+
+		if b.Storage == nil {
+			return nil, fmt.Errorf("bridge %s has no storage, dead letters are kept in memory", name)
+		}
+
+		st, err := store.New(b.Storage.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage of bridge %s, is trigger sync running? %w", name, err)
+		}
+
+		return st, nil
+	}
+
+	return nil, fmt.Errorf("bridge %s not found", name)
+}
@@ -53,16 +53,18 @@ func buildCreateIndex(log logger.Logger) *cobra.Command {
 				continue
 			}
 
-			for _, idx := range bridge.IndexMap {
-				log.Info("creating index", "index", idx.IndexName)
-				if err := meili.CreateIndex(ctx, idx.IndexName, idx.PrimaryKey); err != nil {
-					log.Warn("failed to create meilisearch index", "index", idx.IndexName, "error", err)
-					continue
-				}
-
-				log.Info("updating index settings", "index", idx.IndexName)
-				if err := meili.UpdateIndexSettings(ctx, idx.IndexName, idx.Settings); err != nil {
-					log.Warn("failed to update index settings", "index", idx.IndexName, "error", err)
+			for _, indexes := range bridge.IndexMap {
+				for _, idx := range indexes {
+					log.Info("creating index", "index", idx.IndexName)
+					if err := meili.CreateIndex(ctx, idx.IndexName, idx.PrimaryKey); err != nil {
+						log.Warn("failed to create meilisearch index", "index", idx.IndexName, "error", err)
+						continue
+					}
+
+					log.Info("updating index settings", "index", idx.IndexName)
+					if err := meili.UpdateIndexSettings(ctx, idx.IndexName, idx.Settings); err != nil {
+						log.Warn("failed to update index settings", "index", idx.IndexName, "error", err)
+					}
 				}
 			}
 
@@ -117,10 +119,12 @@ func buildIndexSettingsUpdate(log logger.Logger) *cobra.Command {
 				continue
 			}
 
-			for _, idx := range bridge.IndexMap {
-				log.Info("updating index settings", "index", idx.IndexName)
-				if err := meili.UpdateIndexSettings(ctx, idx.IndexName, idx.Settings); err != nil {
-					log.Warn("failed to update index settings", "index", idx.IndexName, "error", err)
+			for _, indexes := range bridge.IndexMap {
+				for _, idx := range indexes {
+					log.Info("updating index settings", "index", idx.IndexName)
+					if err := meili.UpdateIndexSettings(ctx, idx.IndexName, idx.Settings); err != nil {
+						log.Warn("failed to update index settings", "index", idx.IndexName, "error", err)
+					}
 				}
 			}
 
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/bridge"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+func BuildScript(log logger.Logger) *cobra.Command {
+	sc := &cobra.Command{
+		Use:   "script",
+		Short: "document transform scripts",
+	}
+
+	sc.AddCommand(buildScriptTest(log))
+
+	return sc
+}
+
+func buildScriptTest(log logger.Logger) *cobra.Command {
+	test := &cobra.Command{
+		Use:   "test [script]",
+		Short: "run mapping and script of index against sample documents and print result",
+		Long: "run script against sample documents and print result, with --index documents are mapped by " +
+			"fields, transforms and script of index like sync, script argument replaces script of index.",
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cfgPath := configFlag(test)
+	name := bridgeFlag(test)
+	index := test.Flags().String("index", "", "name of index which mapping is applied")
+	input := test.Flags().StringP("input", "i", "", "path to sample documents, JSON object, array or newline delimited JSON")
+	timeout := test.Flags().Int64P("timeout", "t", 1000, "timeout of script for every document in milliseconds")
+
+	test.RunE = func(cmd *cobra.Command, args []string) error {
+		des := new(config.IndexConfig)
+		if *index != "" {
+			var err error
+			des, err = findIndexConfig(*cfgPath, *name, *index)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(args) == 1 {
+			des.Script = &config.Script{Path: args[0], Timeout: *timeout}
+		}
+
+		if des.Script == nil && *index == "" {
+			return errors.New("script or index is required")
+		}
+
+		if *input == "" {
+			return errors.New("input is required")
+		}
+
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		docs, err := decodeSamples(f)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		for i, doc := range docs {
+			out, err := bridge.MapDocuments(cmd.Context(), []map[string]any{doc}, des)
+			if err != nil {
+				return fmt.Errorf("document %d: %w", i, err)
+			}
+
+			if len(out) == 0 {
+				log.Info("document is dropped", "position", i)
+				continue
+			}
+
+			for _, o := range out {
+				if err := enc.Encode(o); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return test
+}
+
+// findIndexConfig returns config of index of bridge.
+func findIndexConfig(cfgPath, name, index string) (*config.IndexConfig, error) {
+	cfg, err := config.New(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range cfg.Bridges {
+		if b.Name != name {
+			continue
+		}
+
+		for _, indexes := range b.IndexMap {
+			for _, des := range indexes {
+				if des.IndexName == index {
+					return des, nil
+				}
+			}
+		}
+
+		return nil, fmt.Errorf("index %s not found in bridge %s", index, name)
+	}
+
+	return nil, fmt.Errorf("bridge %s not found", name)
+}
+
+func decodeSamples(r io.Reader) ([]map[string]any, error) {
+	dec := json.NewDecoder(r)
+	docs := make([]map[string]any, 0)
+
+	for {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		var batch []map[string]any
+		if err := json.Unmarshal(v, &batch); err == nil {
+			docs = append(docs, batch...)
+			continue
+		}
+
+		var doc map[string]any
+		if err := json.Unmarshal(v, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
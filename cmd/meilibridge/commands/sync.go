@@ -8,7 +8,6 @@ import (
 
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/bridge"
-	"github.com/Ja7ad/meilibridge/pkg/database"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"github.com/spf13/cobra"
 )
@@ -38,6 +37,9 @@ func buildStart(log logger.Logger) *cobra.Command {
 	}
 
 	cfgPath := configFlag(start)
+	snapshot := start.Flags().Bool("snapshot", false, "load indexes with bulk sync before streaming changes, mongo only loads indexes without resume token")
+	workers := start.Flags().Int("workers", 4, "ordered workers of change stream of every mongo index, events of same document keep order")
+	coalesce := start.Flags().Duration("coalesce", 100*time.Millisecond, "window which mongo events of same document are merged in, 0 applies every event")
 
 	start.RunE = func(cmd *cobra.Command, args []string) error {
 		ctx := interruptSignal(cmd.Context(), log)
@@ -46,10 +48,15 @@ func buildStart(log logger.Logger) *cobra.Command {
 		if err != nil {
 			return err
 		}
+		defer b.Close()
 
 		startPProf(log, cfg.General)
 
-		if err := b.Sync(ctx); err != nil {
+		if err := b.Sync(ctx, bridge.SyncOptions{
+			Snapshot: *snapshot,
+			Workers:  *workers,
+			Coalesce: *coalesce,
+		}); err != nil {
 			return err
 		}
 
@@ -68,14 +75,37 @@ func buildBulk(log logger.Logger) *cobra.Command {
 	cfgPath := configFlag(bulk)
 	con := bulk.Flags().Bool("continue", false, "sync new data on exists index")
 	auto := bulk.Flags().Bool("auto", false, "auto bulk sync on exists index every n seconds")
+	reconcile := bulk.Flags().Bool("reconcile", false, "delete documents from index which no longer exist in source after continue bulk")
+	dryRun := bulk.Flags().Bool("dry-run", false, "with --reconcile only report documents which reconcile would delete, without syncing")
+	swap := bulk.Flags().Bool("swap", false, "reindex into temporary index and swap it with live index without downtime")
 
 	bulk.RunE = func(cmd *cobra.Command, args []string) error {
+		// full bulk recreates index, so there is nothing to reconcile
+		if *reconcile && !*con && !*auto {
+			return errors.New("--reconcile requires --continue or --auto")
+		}
+
+		// dry run reports what reconcile would delete, so it's reconcile only
+		if *dryRun && !*reconcile {
+			return errors.New("--dry-run requires --reconcile")
+		}
+
+		// continue and auto bulk write to live index, there is nothing to swap
+		if *swap && (*con || *auto) {
+			return errors.New("--swap can't be used with --continue or --auto")
+		}
+
 		ctx := interruptSignal(cmd.Context(), log)
 
 		b, cfg, err := initBridges(ctx, *cfgPath, log)
 		if err != nil {
 			return err
 		}
+		defer b.Close()
+
+		if *dryRun {
+			return b.Reconcile(ctx, true)
+		}
 
 		if *auto {
 			log.Info("auto bulk scheduler started")
@@ -89,17 +119,27 @@ func buildBulk(log logger.Logger) *cobra.Command {
 					log.Warn("auto bulk sync stopped")
 					return nil
 				case <-ticker.C:
-					if err := b.BulkSync(ctx, true); err != nil {
+					if err := b.BulkSync(ctx, bridge.BulkOptions{Continue: true}); err != nil {
 						return err
 					}
+
+					if *reconcile {
+						if err := b.Reconcile(ctx, false); err != nil {
+							return err
+						}
+					}
 				}
 			}
 		}
 
-		if err := b.BulkSync(ctx, *con); err != nil {
+		if err := b.BulkSync(ctx, bridge.BulkOptions{Continue: *con, Swap: *swap}); err != nil {
 			return err
 		}
 
+		if *reconcile {
+			return b.Reconcile(ctx, false)
+		}
+
 		return nil
 	}
 
@@ -121,6 +161,7 @@ func buildTrigger(log logger.Logger) *cobra.Command {
 		if err != nil {
 			return err
 		}
+		defer b.Close()
 
 		if cfg.General.TriggerSync == nil {
 			return errors.New("trigger sync configuration is null")
@@ -144,18 +185,12 @@ func initBridges(ctx context.Context, cfgPath string, log logger.Logger) (*bridg
 		return nil, nil, err
 	}
 
-	for _, b := range cfg.Bridges {
-		err = database.AddEngine(
-			ctx,
-			b.Database,
-			log,
-		)
-		if err != nil {
-			return nil, nil, err
-		}
+	b, err := bridge.New(ctx, cfg.Bridges, cfg.General.TriggerSync, log)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return bridge.New(cfg.Bridges, cfg.General.TriggerSync, log), cfg, nil
+	return b, cfg, nil
 }
 
 func startPProf(log logger.Logger, general *config.General) {
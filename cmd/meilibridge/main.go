@@ -23,6 +23,8 @@ func main() {
 	root.AddCommand(commands.BuildSync(log))
 	root.AddCommand(commands.BuildVersion())
 	root.AddCommand(commands.BuildIndex(log))
+	root.AddCommand(commands.BuildDeadLetter(log))
+	root.AddCommand(commands.BuildScript(log))
 
 	err := root.Execute()
 	if err != nil {
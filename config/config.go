@@ -4,10 +4,26 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	_defaultServerID    = 1001
+	_defaultSlot        = "meilibridge_slot"
+	_defaultPublication = "meilibridge_publication"
+	_defaultMaxAttempts = 5
+	_defaultBackoff     = 5
+	_defaultMaxBackoff  = 300
+	_defaultSeparator   = "_"
+	_defaultScriptTime  = 1000
+	_defaultForeignKey  = "_id"
+	_defaultTypeField   = "type"
+	_defaultBatchSize   = 1000
+	_defaultBatchWindow = 100
+)
+
 func New(configPath string) (*Config, error) {
 	file, err := os.Open(configPath)
 	if err != nil {
@@ -32,10 +48,36 @@ func (c *Config) Validate() error {
 		c.General.AutoBulkInterval = 1
 	}
 
+	if c.General.TriggerSync != nil {
+		if c.General.TriggerSync.Retry == nil {
+			c.General.TriggerSync.Retry = new(Retry)
+		}
+
+		retry := c.General.TriggerSync.Retry
+
+		if retry.MaxAttempts < 1 {
+			retry.MaxAttempts = _defaultMaxAttempts
+		}
+
+		if retry.InitialBackoff < 1 {
+			retry.InitialBackoff = _defaultBackoff
+		}
+
+		if retry.MaxBackoff < 1 {
+			retry.MaxBackoff = _defaultMaxBackoff
+		}
+
+		if retry.MaxBackoff < retry.InitialBackoff {
+			retry.MaxBackoff = retry.InitialBackoff
+		}
+	}
+
 	if c.Bridges == nil {
 		return ErrMissingBridgeConfig
 	}
 
+	names := make(map[string]struct{}, len(c.Bridges))
+
 	for _, bridge := range c.Bridges {
 		if bridge.Name == "" {
 			return ErrBridgeNameIsRequired
@@ -46,6 +88,11 @@ func (c *Config) Validate() error {
 			bridge.Name = fmt.Sprintf("%s", strings.Join(strings.Split(bridge.Name, " "), "-"))
 		}
 
+		if _, exists := names[bridge.Name]; exists {
+			return ErrDuplicateBridgeName
+		}
+		names[bridge.Name] = struct{}{}
+
 		if bridge.Meilisearch == nil {
 			return ErrMissingMeilisearchConfig
 		}
@@ -53,10 +100,26 @@ func (c *Config) Validate() error {
 			return ErrAPIUrlRequire
 		}
 
+		if bridge.Meilisearch.Batch == nil {
+			bridge.Meilisearch.Batch = new(Batch)
+		}
+
+		if bridge.Meilisearch.Batch.Size < 1 {
+			bridge.Meilisearch.Batch.Size = _defaultBatchSize
+		}
+
+		if bridge.Meilisearch.Batch.Window < 1 {
+			bridge.Meilisearch.Batch.Window = _defaultBatchWindow
+		}
+
 		if bridge.IndexMap == nil {
 			return ErrIndexMapRequire
 		}
 
+		if bridge.Storage != nil && bridge.Storage.Path == "" {
+			return ErrStoragePathRequire
+		}
+
 		if bridge.Database == nil {
 			return ErrMissingSourceConfig
 		}
@@ -75,40 +138,275 @@ func (c *Config) Validate() error {
 
 		switch bridge.Database.Engine {
 		case MONGO:
-		case MYSQL, POSTGRES:
+		case MYSQL:
+			if bridge.Database.Replication == nil {
+				bridge.Database.Replication = new(Replication)
+			}
+
+			if bridge.Database.Replication.ServerID == 0 {
+				bridge.Database.Replication.ServerID = _defaultServerID
+			}
+		case POSTGRES:
+			if bridge.Database.Replication == nil {
+				bridge.Database.Replication = new(Replication)
+			}
+
+			if bridge.Database.Replication.Slot == "" {
+				bridge.Database.Replication.Slot = _defaultSlot
+			}
+
+			if bridge.Database.Replication.Publication == "" {
+				bridge.Database.Replication.Publication = _defaultPublication
+			}
 		default:
 			return ErrNotSupportedEngine
 		}
 
-		for collection, index := range bridge.IndexMap {
+		shared := make(map[string][]*IndexConfig)
+
+		for collection, indexes := range bridge.IndexMap {
 			if collection == "" {
 				return ErrCollectionNameRequire
 			}
 
-			if index == nil {
+			if len(indexes) == 0 {
 				return ErrBridgeDestinationRequire
 			}
 
-			if index.IndexName == "" {
-				return ErrIndexNameRequire
-			}
+			for _, index := range indexes {
+				if index == nil {
+					return ErrBridgeDestinationRequire
+				}
 
-			if index.PrimaryKey == "" {
-				return ErrPrimaryKeyIsRequire
-			}
+				if index.IndexName == "" {
+					return ErrIndexNameRequire
+				}
+
+				if index.PrimaryKey == "" {
+					return ErrPrimaryKeyIsRequire
+				}
+
+				if index.Key != nil {
+					if bridge.Database.Engine == MONGO {
+						return ErrKeyNotSupported
+					}
+
+					if len(index.Key.Columns) == 0 {
+						return ErrKeyColumnsRequire
+					}
+
+					switch index.Key.Encoding {
+					case "":
+						index.Key.Encoding = JOINED
+					case JOINED, HASHED, BASE64URL:
+					default:
+						return ErrKeyEncodingInvalid
+					}
+
+					if index.Key.Separator == "" {
+						index.Key.Separator = _defaultSeparator
+					}
+				}
+
+				if index.Incremental != nil {
+					if index.Incremental.Column == "" {
+						return ErrIncrementalColRequire
+					}
+
+					if bridge.Storage == nil {
+						return ErrIncrementalNoStorage
+					}
+				}
+
+				if index.Flatten != nil && index.Flatten.Separator == "" {
+					index.Flatten.Separator = _defaultSeparator
+				}
+
+				if index.Filter != nil {
+					if bridge.Database.Engine == MONGO && len(index.Filter.Mongo) == 0 {
+						return ErrFilterMongoRequire
+					}
+
+					if bridge.Database.Engine != MONGO && index.Filter.SQL == "" {
+						return ErrFilterSQLRequire
+					}
+				}
+
+				if index.Query != nil {
+					if bridge.Database.Engine == MONGO {
+						return ErrQueryNotSupported
+					}
 
-			if index.Fields != nil {
-				pk, ok := index.Fields[index.PrimaryKey]
-				if !ok {
-					break
+					if index.Query.SQL == "" {
+						return ErrQuerySQLRequire
+					}
+
+					if index.Query.PrimaryKey == "" && index.Key == nil {
+						return ErrQueryPrimaryKeyRequire
+					}
+
+					if collection.HasView() {
+						return ErrQueryWithView
+					}
+				}
+
+				if len(index.Pipeline) > 0 {
+					if bridge.Database.Engine != MONGO {
+						return ErrPipelineNotSupported
+					}
+
+					if collection.HasView() {
+						return ErrPipelineWithView
+					}
+
+					for _, stage := range index.Pipeline {
+						if len(stage) != 1 {
+							return ErrPipelineStageInvalid
+						}
+
+						for op := range stage {
+							if !strings.HasPrefix(op, "$") {
+								return ErrPipelineStageInvalid
+							}
+						}
+					}
 				}
 
-				if pk != "" && index.PrimaryKey != pk {
+				if len(index.Dependencies) > 0 {
+					if bridge.Database.Engine != MONGO {
+						return ErrDependencyNotSupported
+					}
+
+					if !collection.HasView() && len(index.Pipeline) == 0 {
+						return ErrDependencySourceRequire
+					}
+
+					for _, dep := range index.Dependencies {
+						if dep.Collection == "" {
+							return ErrDependencyColRequire
+						}
+
+						if dep.LocalField == "" {
+							return ErrDependencyLocalRequire
+						}
+
+						if dep.ForeignField == "" {
+							dep.ForeignField = _defaultForeignKey
+						}
+					}
+				}
+
+				if index.Script != nil {
+					if index.Script.Path == "" {
+						return ErrScriptPathRequire
+					}
+
+					if index.Script.Timeout < 1 {
+						index.Script.Timeout = _defaultScriptTime
+					}
+				}
+
+				for fk, fv := range index.Fields {
+					if strings.Contains(fk, "[]") && fv == "" {
+						return ErrProjectionNameRequire
+					}
+				}
+
+				for _, tr := range index.Transforms {
+					if err := tr.validate(); err != nil {
+						return err
+					}
+				}
+
+				if index.Discriminator != nil {
+					if index.Discriminator.Value == "" {
+						return ErrDiscriminatorRequire
+					}
+
+					if index.Discriminator.Field == "" {
+						index.Discriminator.Field = _defaultTypeField
+					}
+				}
+
+				shared[index.IndexName] = append(shared[index.IndexName], index)
+
+				if pk, ok := index.Fields[index.PrimaryKey]; ok && pk != "" && index.PrimaryKey != pk {
 					return ErrInvalidPrimaryKey
 				}
 			}
 		}
 
+		for _, indexes := range shared {
+			if err := validateSharedIndex(indexes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSharedIndex checks indexes of many sources which have same index name,
+// discriminator is optional but if one source has it all sources must have it.
+func validateSharedIndex(indexes []*IndexConfig) error {
+	if len(indexes) < 2 {
+		return nil
+	}
+
+	first := indexes[0]
+	values := make(map[string]struct{}, len(indexes))
+
+	for _, index := range indexes {
+		if index.PrimaryKey != first.PrimaryKey {
+			return ErrSharedIndexPrimaryKey
+		}
+
+		if first.Discriminator == nil && index.Discriminator == nil {
+			continue
+		}
+
+		if first.Discriminator == nil || index.Discriminator == nil ||
+			index.Discriminator.Field != first.Discriminator.Field {
+			return ErrSharedIndexDiscriminator
+		}
+
+		if _, ok := values[index.Discriminator.Value]; ok {
+			return ErrDuplicateDiscriminator
+		}
+		values[index.Discriminator.Value] = struct{}{}
+	}
+
+	return nil
+}
+
+func (t *Transform) validate() error {
+	switch t.Type {
+	case DROP_NULL:
+		return nil
+	case CAST, TIMESTAMP, CONCAT, DEFAULT, LOWERCASE, TRIM:
+	default:
+		return ErrTransformTypeInvalid
+	}
+
+	if t.Field == "" {
+		return ErrTransformFieldRequire
+	}
+
+	switch t.Type {
+	case CAST:
+		switch t.To {
+		case "int", "float", "string", "bool":
+		default:
+			return ErrTransformCastInvalid
+		}
+	case TIMESTAMP:
+		if t.Layout == "" {
+			t.Layout = time.RFC3339
+		}
+	case CONCAT:
+		if len(t.Fields) == 0 {
+			return ErrTransformConcatRequire
+		}
 	}
 
 	return nil
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestConfig_New(t *testing.T) {
@@ -37,19 +39,19 @@ func TestConfig_Validate(t *testing.T) {
 							Database:     "mydb",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
-							},
+							}},
 						},
 					},
 				},
@@ -72,18 +74,18 @@ func TestConfig_Validate(t *testing.T) {
 							Database:     "mydb",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -109,18 +111,18 @@ func TestConfig_Validate(t *testing.T) {
 							Database:     "mydb",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -138,18 +140,18 @@ func TestConfig_Validate(t *testing.T) {
 							APIKey: "masterKey",
 						},
 						Database: nil,
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -175,18 +177,18 @@ func TestConfig_Validate(t *testing.T) {
 							Database:     "mydb",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -207,18 +209,18 @@ func TestConfig_Validate(t *testing.T) {
 							Engine:   "mongo",
 							Database: "mydb",
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -243,18 +245,18 @@ func TestConfig_Validate(t *testing.T) {
 							Password:     "foobar",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -278,18 +280,18 @@ func TestConfig_Validate(t *testing.T) {
 							Password:     "foobar",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName:  "idx1",
 								PrimaryKey: "id",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
@@ -345,23 +347,412 @@ func TestConfig_Validate(t *testing.T) {
 							Database:     "mydb",
 							CustomParams: make(map[string]interface{}),
 						},
-						IndexMap: map[Collection]*IndexConfig{
-							"col1": {
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
 								IndexName: "idx1",
 								Fields: map[string]string{
 									"foo": "foo",
 									"bar": "",
 								},
-							},
-							"col2": {
+							}},
+							"col2": {{
 								IndexName: "idx1",
-							},
+							}},
 						},
 					},
 				},
 			},
 			wantError: ErrPrimaryKeyIsRequire,
 		},
+		{
+			name: "duplicate bridge name",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+							}},
+						},
+					},
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrDuplicateBridgeName,
+		},
+		{
+			name: "incremental without storage",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Incremental: &Incremental{
+									Column: "updated_at",
+								},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrIncrementalNoStorage,
+		},
+		{
+			name: "invalid transform cast",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Transforms: []*Transform{
+									{Type: CAST, Field: "price", To: "decimal"},
+								},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrTransformCastInvalid,
+		},
+		{
+			name: "array projection without name",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Fields: map[string]string{
+									"id":          "",
+									"tags[].name": "",
+								},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrProjectionNameRequire,
+		},
+		{
+			name: "script without path",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Script:     &Script{Timeout: 100},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrScriptPathRequire,
+		},
+		{
+			name: "mongo filter with sql",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Filter:     &Filter{SQL: "is_active = ?", Params: []any{true}},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrFilterMongoRequire,
+		},
+		{
+			name: "query without primary key",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mysql",
+							Host:     "127.0.0.1",
+							Port:     3306,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"users": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Query:      &Query{SQL: "SELECT u.id, b.title FROM users u JOIN books b ON b.user_id = u.id"},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrQueryPrimaryKeyRequire,
+		},
+		{
+			name: "key with invalid encoding",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mysql",
+							Host:     "127.0.0.1",
+							Port:     3306,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"products": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Key:        &Key{Columns: []string{"tenant_id", "sku"}, Encoding: "md5"},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrKeyEncodingInvalid,
+		},
+		{
+			name: "key with mongo",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Key:        &Key{Columns: []string{"tenant_id", "sku"}},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrKeyNotSupported,
+		},
+		{
+			name: "pipeline stage with many operators",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:  "idx1",
+								PrimaryKey: "id",
+								Pipeline: []map[string]any{
+									{"$project": map[string]any{"name": 1}, "$addFields": map[string]any{"x": 1}},
+								},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrPipelineStageInvalid,
+		},
+		{
+			name: "dependencies without view",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:    "idx1",
+								PrimaryKey:   "id",
+								Dependencies: []*Dependency{{Collection: "col2", LocalField: "col2_id"}},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrDependencySourceRequire,
+		},
+		{
+			name: "duplicate discriminator",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {{
+								IndexName:     "idx1",
+								PrimaryKey:    "id",
+								Discriminator: &Discriminator{Value: "foo"},
+							}},
+							"col2": {{
+								IndexName:     "idx1",
+								PrimaryKey:    "id",
+								Discriminator: &Discriminator{Value: "foo"},
+							}},
+						},
+					},
+				},
+			},
+			wantError: ErrDuplicateDiscriminator,
+		},
+		{
+			name: "second index of collection with renamed primary key is validated",
+			config: &Config{
+				Bridges: []*Bridge{
+					{
+						Name: "bridge1",
+						Meilisearch: &Meilisearch{
+							APIURL: "http://localhost:7700",
+						},
+						Database: &Database{
+							Engine:   "mongo",
+							Host:     "127.0.0.1",
+							Port:     27017,
+							Database: "mydb",
+						},
+						IndexMap: map[Collection]Indexes{
+							"col1": {
+								{
+									IndexName:  "idx1",
+									PrimaryKey: "id",
+									Fields:     map[string]string{"_id": "id"},
+								},
+								{
+									IndexName:  "idx2",
+									PrimaryKey: "id",
+									Transforms: []*Transform{{Type: "unknown", Field: "foo"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantError: ErrTransformTypeInvalid,
+		},
 	}
 
 	for _, tt := range tests {
@@ -372,6 +763,66 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidateIndexesDefaults(t *testing.T) {
+	second := &IndexConfig{
+		IndexName:  "idx2",
+		PrimaryKey: "id",
+		Script:     &Script{Path: "script.js"},
+		Flatten:    &Flatten{},
+	}
+
+	cfg := &Config{
+		Bridges: []*Bridge{
+			{
+				Name: "bridge1",
+				Meilisearch: &Meilisearch{
+					APIURL: "http://localhost:7700",
+				},
+				Database: &Database{
+					Engine:   "mongo",
+					Host:     "127.0.0.1",
+					Port:     27017,
+					Database: "mydb",
+				},
+				IndexMap: map[Collection]Indexes{
+					"col1": {
+						{
+							IndexName:  "idx1",
+							PrimaryKey: "id",
+							Fields:     map[string]string{"_id": "id"},
+						},
+						second,
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, cfg.Validate())
+	assert.EqualValues(t, _defaultScriptTime, second.Script.Timeout)
+	assert.Equal(t, _defaultSeparator, second.Flatten.Separator)
+}
+
+func TestIndexes_UnmarshalYAML(t *testing.T) {
+	var indexMap map[Collection]Indexes
+	err := yaml.Unmarshal([]byte(`
+users:
+  index_name: users
+  primary_key: id
+posts:
+  - index_name: posts_en
+    primary_key: id
+  - index_name: posts_fr
+    primary_key: id
+`), &indexMap)
+	require.NoError(t, err)
+
+	assert.Len(t, indexMap["users"], 1)
+	assert.Equal(t, "users", indexMap["users"][0].IndexName)
+	assert.Len(t, indexMap["posts"], 2)
+	assert.Equal(t, "posts_fr", indexMap["posts"][1].IndexName)
+}
+
 func TestCollection_GetCollectionAndView(t *testing.T) {
 	tests := []struct {
 		input    Collection
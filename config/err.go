@@ -19,4 +19,34 @@ var (
 	ErrDatabaseHostIsRequired   = errors.New("database host is required")
 	ErrDatabasePortIsRequired   = errors.New("database port is required")
 	ErrBridgeNameIsRequired     = errors.New("bridge name is required")
+	ErrStoragePathRequire       = errors.New("bridge storage path is required")
+	ErrDuplicateBridgeName      = errors.New("bridge name must be unique")
+	ErrIncrementalColRequire    = errors.New("incremental column is required")
+	ErrIncrementalNoStorage     = errors.New("bridge storage is required for incremental sync")
+	ErrTransformTypeInvalid     = errors.New("transform type is not supported")
+	ErrTransformFieldRequire    = errors.New("transform field is required")
+	ErrTransformCastInvalid     = errors.New("transform cast type must be int, float, string or bool")
+	ErrTransformConcatRequire   = errors.New("transform concat fields are required")
+	ErrProjectionNameRequire    = errors.New("array projection field requires new name")
+	ErrScriptPathRequire        = errors.New("script path is required")
+	ErrFilterSQLRequire         = errors.New("filter sql is required for sql engine")
+	ErrFilterMongoRequire       = errors.New("filter mongo is required for mongo engine")
+	ErrQueryNotSupported        = errors.New("query source is only supported by sql engines")
+	ErrQuerySQLRequire          = errors.New("query sql is required")
+	ErrQueryPrimaryKeyRequire   = errors.New("query primary key is required")
+	ErrQueryWithView            = errors.New("query source can't be used with view")
+	ErrPipelineNotSupported     = errors.New("pipeline source is only supported by mongo engine")
+	ErrPipelineWithView         = errors.New("pipeline source can't be used with view")
+	ErrPipelineStageInvalid     = errors.New("pipeline stage must have single operator")
+	ErrDependencyNotSupported   = errors.New("dependencies are only supported by mongo engine")
+	ErrDependencySourceRequire  = errors.New("dependencies require view or pipeline")
+	ErrDependencyColRequire     = errors.New("dependency collection is required")
+	ErrDependencyLocalRequire   = errors.New("dependency local field is required")
+	ErrDiscriminatorRequire     = errors.New("discriminator value is required")
+	ErrSharedIndexDiscriminator = errors.New("all sources of index must have discriminator with same field")
+	ErrSharedIndexPrimaryKey    = errors.New("index of many sources requires same primary key")
+	ErrDuplicateDiscriminator   = errors.New("discriminator value must be unique in index")
+	ErrKeyNotSupported          = errors.New("key columns are only supported by sql engines")
+	ErrKeyColumnsRequire        = errors.New("key columns are required")
+	ErrKeyEncodingInvalid       = errors.New("key encoding must be joined, hashed or base64url")
 )
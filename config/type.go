@@ -1,6 +1,10 @@
 package config
 
-import "strings"
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Config struct {
 	General *General  `yaml:"general"`
@@ -16,6 +20,14 @@ type General struct {
 type TriggerSync struct {
 	Token  string `yaml:"token"`
 	Listen string `yaml:"listen"`
+	Retry  *Retry `yaml:"retry"`
+}
+
+// Retry is retry policy of failed trigger items, backoff is in seconds.
+type Retry struct {
+	MaxAttempts    int   `yaml:"max_attempts"`
+	InitialBackoff int64 `yaml:"initial_backoff"`
+	MaxBackoff     int64 `yaml:"max_backoff"`
 }
 
 type PProf struct {
@@ -24,15 +36,51 @@ type PProf struct {
 }
 
 type Bridge struct {
-	Name        string                      `yaml:"name"`
-	Meilisearch *Meilisearch                `yaml:"meilisearch"`
-	Database    *Database                   `yaml:"database"`
-	IndexMap    map[Collection]*IndexConfig `yaml:"index_map"`
+	Name        string                 `yaml:"name"`
+	Meilisearch *Meilisearch           `yaml:"meilisearch"`
+	Database    *Database              `yaml:"database"`
+	Storage     *Storage               `yaml:"storage"`
+	IndexMap    map[Collection]Indexes `yaml:"index_map"`
+}
+
+// Indexes is list of indexes which collection feeds, single index can be written
+// as mapping instead of list.
+type Indexes []*IndexConfig
+
+func (i *Indexes) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		idx := new(IndexConfig)
+		if err := value.Decode(idx); err != nil {
+			return err
+		}
+		*i = Indexes{idx}
+		return nil
+	}
+
+	var list []*IndexConfig
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*i = list
+
+	return nil
+}
+
+type Storage struct {
+	Path string `yaml:"path"`
 }
 
 type Meilisearch struct {
 	APIURL string `yaml:"api_url"`
 	APIKey string `yaml:"api_key"`
+	Batch  *Batch `yaml:"batch"`
+}
+
+// Batch groups real-time writes of index into one task, batch is submitted when
+// it has Size documents or Window (milliseconds) passed since its first write.
+type Batch struct {
+	Size   int   `yaml:"size"`
+	Window int64 `yaml:"window"`
 }
 
 type Database struct {
@@ -43,13 +91,106 @@ type Database struct {
 	Password     string                 `yaml:"password"`
 	Database     string                 `yaml:"database"`
 	CustomParams map[string]interface{} `yaml:"custom_params"`
+	Replication  *Replication           `yaml:"replication"`
+}
+
+type Replication struct {
+	ServerID    uint32 `yaml:"server_id"`
+	Slot        string `yaml:"slot"`
+	Publication string `yaml:"publication"`
 }
 
 type IndexConfig struct {
-	IndexName  string            `yaml:"index_name"`
-	PrimaryKey string            `yaml:"primary_key"`
-	Fields     map[string]string `yaml:"fields"`
-	Settings   *Settings         `yaml:"settings"`
+	IndexName     string            `yaml:"index_name"`
+	PrimaryKey    string            `yaml:"primary_key"`
+	Key           *Key              `yaml:"key"`
+	Fields        map[string]string `yaml:"fields"`
+	Settings      *Settings         `yaml:"settings"`
+	Incremental   *Incremental      `yaml:"incremental"`
+	Transforms    []*Transform      `yaml:"transforms"`
+	Flatten       *Flatten          `yaml:"flatten"`
+	Script        *Script           `yaml:"script"`
+	Filter        *Filter           `yaml:"filter"`
+	Query         *Query            `yaml:"query"`
+	Pipeline      []map[string]any  `yaml:"pipeline"`
+	Dependencies  []*Dependency     `yaml:"dependencies"`
+	Discriminator *Discriminator    `yaml:"discriminator"`
+}
+
+// Key builds primary key of index from Columns of source row, it's for composite
+// keys and keys which aren't valid meilisearch ids (dots, slashes). Built key is
+// written to PrimaryKey field of document.
+type Key struct {
+	Columns  []string    `yaml:"columns"`
+	Encoding KeyEncoding `yaml:"encoding"`
+	// Separator joins columns of joined encoding, default is "_".
+	Separator string `yaml:"separator"`
+}
+
+// Discriminator writes Value to Field of every document, so documents of many
+// sources which share one index can be told apart.
+type Discriminator struct {
+	Field string `yaml:"field"`
+	Value string `yaml:"value"`
+}
+
+// Dependency is collection joined by view or pipeline of index, LocalField of
+// source document references ForeignField of dependency document. Change of
+// dependency document reindexes all source documents which reference it.
+type Dependency struct {
+	Collection   string `yaml:"collection"`
+	LocalField   string `yaml:"local_field"`
+	ForeignField string `yaml:"foreign_field"`
+}
+
+// Query is raw SELECT of sql engines which is used as source of index instead of
+// table, PrimaryKey is column of query used for pagination and lookups. Table
+// of collection key is still watched for real-time sync.
+type Query struct {
+	SQL        string `yaml:"sql"`
+	PrimaryKey string `yaml:"primary_key"`
+}
+
+// Filter limits rows of index, SQL is WHERE fragment with ? placeholders bound
+// by Params and Mongo is filter document. Documents which stop matching filter
+// are removed from index.
+type Filter struct {
+	SQL    string         `yaml:"sql"`
+	Params []any          `yaml:"params"`
+	Mongo  map[string]any `yaml:"mongo"`
+}
+
+// Script is Starlark script which defines transform(doc) function, it's applied
+// to every document after transforms. Timeout is in milliseconds.
+type Script struct {
+	Path    string `yaml:"path"`
+	Timeout int64  `yaml:"timeout"`
+}
+
+// Flatten moves fields of nested objects to top level of document, keys are
+// joined by Separator.
+type Flatten struct {
+	Separator string `yaml:"separator"`
+}
+
+// Incremental tracks high-water mark of column (e.g. updated_at or auto increment id),
+// so continue bulk sync only pushes rows changed since last successful run.
+type Incremental struct {
+	Column string `yaml:"column"`
+}
+
+// Transform changes field of document after fields mapping, so Field and Fields
+// are names of fields in index. Transforms are applied in order.
+type Transform struct {
+	Type  TransformType `yaml:"type"`
+	Field string        `yaml:"field"`
+	// To is target type of cast, one of int, float, string or bool.
+	To string `yaml:"to"`
+	// Layout is layout of string dates for timestamp, default is RFC3339.
+	Layout    string   `yaml:"layout"`
+	Fields    []string `yaml:"fields"`
+	Separator string   `yaml:"separator"`
+	Value     any      `yaml:"value"`
 }
 
 type Settings struct {
@@ -96,9 +237,11 @@ type Embedder struct {
 }
 
 type (
-	Engine     string
-	Collection string
-	Index      string
+	Engine        string
+	Collection    string
+	Index         string
+	TransformType string
+	KeyEncoding   string
 )
 
 const (
@@ -108,6 +251,26 @@ const (
 	PLUGIN   Engine = "plugin"
 )
 
+const (
+	CAST      TransformType = "cast"
+	TIMESTAMP TransformType = "timestamp"
+	CONCAT    TransformType = "concat"
+	DEFAULT   TransformType = "default"
+	LOWERCASE TransformType = "lowercase"
+	TRIM      TransformType = "trim"
+	DROP_NULL TransformType = "drop_null"
+)
+
+const (
+	// JOINED joins columns by separator, key with characters which meilisearch
+	// doesn't accept, separator in a value or too long is HASHED instead.
+	JOINED KeyEncoding = "joined"
+	// HASHED is hex of sha256 of columns.
+	HASHED KeyEncoding = "hashed"
+	// BASE64URL is unpadded base64url of columns, it's reversible.
+	BASE64URL KeyEncoding = "base64url"
+)
+
 func (e Engine) String() string { return string(e) }
 
 func (c Collection) String() string { return string(c) }
@@ -22,18 +22,18 @@ const (
 func setup(t *testing.T, source *config.Database) database.SQLExecutor {
 	ctx := context.Background()
 
-	err := database.AddEngine(ctx, source, logger.DefaultLogger)
+	err := database.AddEngine(ctx, t.Name(), source, logger.DefaultLogger)
 	require.NoError(t, err)
 
-	sqldb := database.GetEngine[database.SQLExecutor](config.MYSQL)
+	sqldb := database.GetEngine[database.SQLExecutor](t.Name())
 	require.NotNil(t, sqldb)
 
 	return sqldb
 }
 
-func cleanup(closeFunc func() error) func() {
+func cleanup(name string) func() {
 	return func() {
-		_ = closeFunc()
+		_ = database.RemoveEngine(name)
 	}
 }
 
@@ -48,9 +48,9 @@ func Test_Count(t *testing.T) {
 	}
 
 	sq := setup(t, src)
-	t.Cleanup(cleanup(sq.Close))
+	t.Cleanup(cleanup(t.Name()))
 
-	count, err := sq.Count(context.Background(), viewUserBooks)
+	count, err := sq.Count(context.Background(), viewUserBooks, nil)
 	assert.NoError(t, err)
 	assert.NotEqual(t, 0, count)
 }
@@ -66,13 +66,13 @@ func Test_FindOne(t *testing.T) {
 	}
 
 	sq := setup(t, src)
-	t.Cleanup(cleanup(sq.Close))
+	t.Cleanup(cleanup(t.Name()))
 
 	id := int64(1)
 
 	res, err := sq.FindOne(context.Background(), tableUser, map[string]interface{}{
 		"id": id,
-	})
+	}, nil)
 	require.NoError(t, err)
 	require.NotNil(t, res)
 	assert.Greater(t, len(res), 0)
@@ -90,16 +90,16 @@ func Test_FindLimit(t *testing.T) {
 	}
 
 	sq := setup(t, src)
-	t.Cleanup(cleanup(sq.Close))
+	t.Cleanup(cleanup(t.Name()))
 
 	ctx := context.Background()
 
-	total, err := sq.Count(ctx, viewUserBooks)
+	total, err := sq.Count(ctx, tableUser, nil)
 	require.NoError(t, err)
 
 	limit := 2
 
-	cur, err := sq.FindLimit(ctx, viewUserBooks, int64(limit))
+	cur, err := sq.FindLimit(ctx, tableUser, []string{"id"}, int64(limit), nil, nil)
 	require.NoError(t, err)
 	require.NotNil(t, cur)
 
@@ -0,0 +1,134 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Ja7ad/meilibridge/pkg/types"
+)
+
+const (
+	_batchPattern  = "/%s/_batch"
+	_maxBatchSize  = 10000
+	_maxBatchBytes = 32 << 20
+)
+
+// batchTriggerHandler queues valid items of batch with one write, items are
+// processed by queue like single triggers, so items of same document are
+// applied in order of batch and failed items are retried.
+func batchTriggerHandler(
+	token string,
+	queue *Queue,
+	validate func(item types.TriggerRequestBody) error,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !isValidTriggerToken(r, token) {
+			http.Error(w, "invalid trigger token", http.StatusUnauthorized)
+			return
+		}
+		defer r.Body.Close()
+
+		items, err := unmarshalTriggerBatch(http.MaxBytesReader(w, r.Body, _maxBatchBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results := make([]types.TriggerItemResult, len(items))
+		valid := make([]types.TriggerRequestBody, 0, len(items))
+
+		for i, item := range items {
+			results[i] = types.TriggerItemResult{Position: i, Status: types.TriggerQueued}
+
+			if err := validate(item); err != nil {
+				results[i].Status, results[i].Error = types.TriggerInvalid, err.Error()
+				continue
+			}
+			valid = append(valid, item)
+		}
+
+		if err := queue.AddAll(valid); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(types.TriggerBatchResponse{Results: results})
+	}
+}
+
+// unmarshalTriggerBatch decodes items of JSON array or newline delimited JSON body.
+func unmarshalTriggerBatch(body io.Reader) ([]types.TriggerRequestBody, error) {
+	br := bufio.NewReader(body)
+
+	first, err := peekNonSpace(br)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("batch is empty")
+		}
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	items := make([]types.TriggerRequestBody, 0)
+
+	if first == '[' {
+		if err := dec.Decode(&items); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var item types.TriggerRequestBody
+			if err := dec.Decode(&item); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("line %d: %w", len(items)+1, err)
+			}
+
+			if len(items) == _maxBatchSize {
+				return nil, fmt.Errorf("batch size is more than %d", _maxBatchSize)
+			}
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("batch is empty")
+	}
+
+	if len(items) > _maxBatchSize {
+		return nil, fmt.Errorf("batch size is more than %d", _maxBatchSize)
+	}
+
+	return items, nil
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if !bytes.ContainsRune([]byte(" \t\r\n"), rune(b)) {
+			return b, br.UnreadByte()
+		}
+	}
+}
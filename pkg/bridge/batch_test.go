@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"github.com/Ja7ad/meilibridge/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_UnmarshalTriggerBatch(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Body  string
+		Count int
+		Err   bool
+	}{
+		{
+			Name:  "array",
+			Body:  ` [{"index_uid":"idx1","type":"INSERT"},{"index_uid":"idx1","type":"DELETE"}]`,
+			Count: 2,
+		},
+		{
+			Name:  "ndjson",
+			Body:  "{\"index_uid\":\"idx1\",\"type\":\"INSERT\"}\n{\"index_uid\":\"idx2\",\"type\":\"DELETE\"}\n",
+			Count: 2,
+		},
+		{
+			Name: "empty",
+			Body: "  \n",
+			Err:  true,
+		},
+		{
+			Name: "broken line",
+			Body: "{\"index_uid\":\"idx1\"}\n{\"index_uid\":",
+			Err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			items, err := unmarshalTriggerBatch(strings.NewReader(tt.Body))
+			if tt.Err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, items, tt.Count)
+		})
+	}
+}
+
+func Test_BatchTriggerHandler(t *testing.T) {
+	st := store.NewMemory()
+	q := newQueue(st, nil, logger.DefaultLogger)
+
+	validate := func(item types.TriggerRequestBody) error {
+		if err := item.Validate(); err != nil {
+			return err
+		}
+		if item.IndexUID != "idx1" {
+			return errInvalidIndexUID
+		}
+		return nil
+	}
+
+	doc := func(v any) *types.Document {
+		return &types.Document{PrimaryKey: "id", PrimaryValue: v}
+	}
+
+	body := strings.Join([]string{
+		`{"index_uid":"idx1","type":"INSERT","document":{"primary_key":"id","primary_value":1}}`,
+		`{"index_uid":"idx2","type":"INSERT","document":{"primary_key":"id","primary_value":1}}`,
+		`{"index_uid":"idx1","type":"DELETE","document":{"primary_key":"id","primary_value":1}}`,
+		`{"index_uid":"idx1","type":"UPDATE"}`,
+		`{"index_uid":"idx1","type":"UPDATE","document":{"primary_key":"id","primary_value":2}}`,
+	}, "\n")
+
+	rec := httptest.NewRecorder()
+	batchTriggerHandler("", q, validate)(rec, httptest.NewRequest(http.MethodPost, "/bridge/_batch", strings.NewReader(body)))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	var resp types.TriggerBatchResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	status := make([]types.TriggerStatus, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		status = append(status, r.Status)
+	}
+
+	assert.Equal(t, []types.TriggerStatus{
+		types.TriggerQueued,
+		types.TriggerInvalid,
+		types.TriggerQueued,
+		types.TriggerInvalid,
+		types.TriggerQueued,
+	}, status)
+
+	// valid items are queued in order of batch
+	items := make([]types.TriggerRequestBody, 0)
+	require.NoError(t, st.ForEach(_queueBucket, func(_ string, data []byte) error {
+		var e queueEntry
+		require.NoError(t, json.Unmarshal(data, &e))
+		items = append(items, e.Item)
+		return nil
+	}))
+
+	assert.Equal(t, []types.TriggerRequestBody{
+		{IndexUID: "idx1", Type: types.INSERT, Document: doc(float64(1))},
+		{IndexUID: "idx1", Type: types.DELETE, Document: doc(float64(1))},
+		{IndexUID: "idx1", Type: types.UPDATE, Document: doc(float64(2))},
+	}, items)
+}
+
+func Test_BatchTriggerHandlerTooLarge(t *testing.T) {
+	q := newQueue(store.NewMemory(), nil, logger.DefaultLogger)
+	validate := func(types.TriggerRequestBody) error { return nil }
+
+	body := `[{"index_uid":"` + strings.Repeat("a", _maxBatchBytes) + `"}]`
+
+	rec := httptest.NewRecorder()
+	batchTriggerHandler("", q, validate)(rec, httptest.NewRequest(http.MethodPost, "/bridge/_batch", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
@@ -0,0 +1,482 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	meili "github.com/meilisearch/meilisearch-go"
+)
+
+const (
+	// _batchQueueSize is count of batches waiting for submit before writers block.
+	_batchQueueSize    = 4
+	_batchAttempts     = 3
+	_batchRetryBackoff = time.Second
+)
+
+type batchOp uint8
+
+const (
+	opUpsert batchOp = iota
+	opReplace
+	opDelete
+)
+
+// batchWrite is write of batcher, it's done when meilisearch task of its batch
+// is finished.
+type batchWrite struct {
+	b     *indexBatcher
+	batch *batch
+
+	mu        sync.Mutex
+	done      chan struct{}
+	err       error
+	callbacks []func(err error)
+}
+
+// Wait submits batch of write without waiting for window and returns result of
+// its meilisearch task.
+func (w *batchWrite) Wait(ctx context.Context) error {
+	if w.b != nil {
+		w.b.mu.Lock()
+		if w.b.open == w.batch {
+			w.b.sealLocked()
+		}
+		w.b.mu.Unlock()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return w.err
+	}
+}
+
+// Notify calls fn with result of write when it's done, it doesn't hurry batch
+// of write like Wait.
+func (w *batchWrite) Notify(fn func(err error)) {
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		fn(w.err)
+		return
+	default:
+	}
+	w.callbacks = append(w.callbacks, fn)
+	w.mu.Unlock()
+}
+
+func (w *batchWrite) finish(err error) {
+	w.mu.Lock()
+	w.err = err
+	close(w.done)
+	callbacks := w.callbacks
+	w.callbacks = nil
+	w.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(err)
+	}
+}
+
+func doneWrite(err error) *batchWrite {
+	w := &batchWrite{done: make(chan struct{}), err: err}
+	close(w.done)
+	return w
+}
+
+// joinWrites returns write which is done when all of writes are done, its error
+// is first error of them.
+func joinWrites(writes ...*batchWrite) *batchWrite {
+	if len(writes) == 0 {
+		return doneWrite(nil)
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = len(writes)
+		first   error
+	)
+
+	joined := &batchWrite{done: make(chan struct{})}
+	for _, w := range writes {
+		w.Notify(func(err error) {
+			mu.Lock()
+			if err != nil && first == nil {
+				first = err
+			}
+			pending--
+			last := pending == 0
+			mu.Unlock()
+
+			if last {
+				joined.finish(first)
+			}
+		})
+	}
+
+	return joined
+}
+
+type pendingDoc struct {
+	doc database.Result
+	seq uint64
+}
+
+type pendingKey struct {
+	id  string
+	seq uint64
+}
+
+// batch is writes of one kind which are submitted as one task.
+type batch struct {
+	op     batchOp
+	docs   []*database.Result
+	ids    []string
+	keys   []pendingKey
+	writes []*batchWrite
+}
+
+func (bt *batch) len() int {
+	return len(bt.docs) + len(bt.ids)
+}
+
+// indexBatcher accumulates upserts and deletes of index and submits them as one
+// task when batch reaches size or window passes. Consecutive writes of same kind
+// share batch and batches are submitted one by one by submitter of batcher, so
+// order of writes is kept and failed batch is retried before next one.
+type indexBatcher struct {
+	ctx          context.Context
+	idx          meili.IndexManager
+	name         string
+	primaryKey   string
+	size         int
+	window       time.Duration
+	retryBackoff time.Duration
+	merge        bool
+	wait         func(ctx context.Context, t *meili.TaskInfo) error
+	log          logger.Logger
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	open    *batch
+	sealed  []*batch
+	timer   *time.Timer
+	seq     uint64
+	pending map[string]pendingDoc
+	closed  bool
+	stopped chan struct{}
+}
+
+// Upsert adds documents to batch, fields of documents are merged into existing
+// ones, so it's only for partial documents.
+func (b *indexBatcher) Upsert(docs []*database.Result) *batchWrite {
+	return b.put(opUpsert, docs)
+}
+
+// Replace adds full documents to batch, existing documents are replaced, so
+// fields removed in source are removed from index. Documents of index which
+// many sources feed are merged, so fields of other sources are kept.
+func (b *indexBatcher) Replace(docs []*database.Result) *batchWrite {
+	if b.merge {
+		return b.put(opUpsert, docs)
+	}
+	return b.put(opReplace, docs)
+}
+
+func (b *indexBatcher) put(op batchOp, docs []*database.Result) *batchWrite {
+	if len(docs) == 0 {
+		return doneWrite(nil)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := b.addLocked(op)
+	for _, doc := range docs {
+		b.open.docs = append(b.open.docs, doc)
+		b.track(keyString((*doc)[b.primaryKey]), *doc)
+	}
+	b.checkLocked()
+
+	return w
+}
+
+// Delete adds ids of documents to batch.
+func (b *indexBatcher) Delete(ids ...string) *batchWrite {
+	if len(ids) == 0 {
+		return doneWrite(nil)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := b.addLocked(opDelete)
+	for _, id := range ids {
+		b.open.ids = append(b.open.ids, id)
+		b.track(id, nil)
+	}
+	b.checkLocked()
+
+	return w
+}
+
+// Pending returns copy of latest document of id which is written but its task
+// isn't finished yet, doc is nil if latest write is delete.
+func (b *indexBatcher) Pending(id string) (database.Result, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, ok := b.pending[id]
+	if !ok || p.doc == nil {
+		return nil, ok
+	}
+
+	doc := make(database.Result, len(p.doc))
+	for k, v := range p.doc {
+		doc[k] = v
+	}
+
+	return doc, true
+}
+
+// Flush seals current batch for submit.
+func (b *indexBatcher) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sealLocked()
+}
+
+// Close submits current batch and waits for submitter to finish all batches.
+func (b *indexBatcher) Close() {
+	b.mu.Lock()
+	b.sealLocked()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	<-b.stopped
+}
+
+func (b *indexBatcher) addLocked(op batchOp) *batchWrite {
+	// writers wait while submitter is behind, so batches don't grow without limit
+	for len(b.sealed) >= _batchQueueSize && !b.closed {
+		b.cond.Wait()
+	}
+
+	// writes of other kind can't share batch
+	if b.open != nil && b.open.op != op {
+		b.sealLocked()
+	}
+
+	if b.open == nil {
+		b.open = &batch{op: op}
+	}
+
+	w := &batchWrite{b: b, batch: b.open, done: make(chan struct{})}
+	b.open.writes = append(b.open.writes, w)
+
+	return w
+}
+
+func (b *indexBatcher) track(id string, doc database.Result) {
+	b.seq++
+	b.pending[id] = pendingDoc{doc: doc, seq: b.seq}
+	b.open.keys = append(b.open.keys, pendingKey{id: id, seq: b.seq})
+}
+
+func (b *indexBatcher) checkLocked() {
+	if b.open.len() >= b.size || b.window <= 0 {
+		b.sealLocked()
+		return
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+}
+
+// sealLocked moves open batch to queue of submitter, no I/O is done while mutex
+// is held.
+func (b *indexBatcher) sealLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if b.open == nil {
+		return
+	}
+
+	b.sealed = append(b.sealed, b.open)
+	b.open = nil
+	b.cond.Broadcast()
+}
+
+// submitter submits sealed batches in order until batcher is closed.
+func (b *indexBatcher) submitter() {
+	defer close(b.stopped)
+
+	for {
+		b.mu.Lock()
+		for len(b.sealed) == 0 && !b.closed {
+			b.cond.Wait()
+		}
+
+		if len(b.sealed) == 0 {
+			b.mu.Unlock()
+			return
+		}
+
+		bt := b.sealed[0]
+		b.sealed = b.sealed[1:]
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		err := b.submit(bt)
+		if err != nil {
+			b.log.Error("failed to write batch to index", "index", b.name, "documents", bt.len(), "err", err.Error())
+		}
+
+		b.mu.Lock()
+		for _, k := range bt.keys {
+			if p, ok := b.pending[k.id]; ok && p.seq == k.seq {
+				delete(b.pending, k.id)
+			}
+		}
+		b.mu.Unlock()
+
+		for _, w := range bt.writes {
+			w.finish(err)
+		}
+	}
+}
+
+// submit writes batch and waits for its task, failed batch is retried with
+// backoff. Next batch waits for it, so retry doesn't reorder writes.
+func (b *indexBatcher) submit(bt *batch) error {
+	backoff := b.retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := b.write(bt)
+		if err == nil || attempt >= _batchAttempts {
+			return err
+		}
+
+		b.log.Warn("failed to write batch to index, retrying", "index", b.name,
+			"attempt", attempt, "err", err.Error())
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (b *indexBatcher) write(bt *batch) error {
+	var (
+		tInfo *meili.TaskInfo
+		err   error
+	)
+
+	switch bt.op {
+	case opUpsert:
+		tInfo, err = b.idx.UpdateDocumentsWithContext(b.ctx, bt.docs, b.primaryKey)
+	case opReplace:
+		tInfo, err = b.idx.AddDocumentsWithContext(b.ctx, bt.docs, b.primaryKey)
+	case opDelete:
+		tInfo, err = b.idx.DeleteDocumentsWithContext(b.ctx, bt.ids)
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.wait(b.ctx, tInfo)
+}
+
+// batchers keeps batcher of every index of syncer, indexes of many sources
+// share one batcher.
+type batchers struct {
+	size   int
+	window time.Duration
+	// shared is indexes which many sources feed, their documents are merged
+	shared map[string]bool
+
+	mu sync.Mutex
+	m  map[string]*indexBatcher
+}
+
+func (bs *batchers) configure(cfg *config.Batch, tasks []task) {
+	bs.shared = make(map[string]bool)
+	for _, g := range groupTasks(tasks) {
+		if len(g) > 1 {
+			bs.shared[g[0].des.IndexName] = true
+		}
+	}
+
+	if cfg == nil {
+		return
+	}
+
+	bs.size = cfg.Size
+	bs.window = time.Duration(cfg.Window) * time.Millisecond
+}
+
+// get returns batcher of index, tasks of batcher aren't canceled with context of
+// first call, so batches submitted on shutdown are finished.
+func (bs *batchers) get(
+	ctx context.Context,
+	idx meili.IndexManager,
+	des *config.IndexConfig,
+	wait func(ctx context.Context, t *meili.TaskInfo) error,
+	log logger.Logger,
+) *indexBatcher {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if b, ok := bs.m[des.IndexName]; ok {
+		return b
+	}
+
+	if bs.m == nil {
+		bs.m = make(map[string]*indexBatcher)
+	}
+
+	b := &indexBatcher{
+		ctx:          context.WithoutCancel(ctx),
+		idx:          idx,
+		name:         des.IndexName,
+		primaryKey:   des.PrimaryKey,
+		size:         max(bs.size, 1),
+		window:       bs.window,
+		retryBackoff: _batchRetryBackoff,
+		merge:        bs.shared[des.IndexName],
+		wait:         wait,
+		log:          log,
+		pending:      make(map[string]pendingDoc),
+		stopped:      make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	bs.m[des.IndexName] = b
+
+	go b.submitter()
+
+	return b
+}
+
+// Close submits batches of all indexes and waits for their tasks, later writes
+// get new batchers.
+func (bs *batchers) Close() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	for _, b := range bs.m {
+		b.Close()
+	}
+	bs.m = nil
+}
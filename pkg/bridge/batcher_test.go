@@ -0,0 +1,257 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	meili "github.com/meilisearch/meilisearch-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchIndex records submitted batches of batcher and keeps documents like
+// index, first fails writes fail.
+type batchIndex struct {
+	meili.IndexManager
+	mu      sync.Mutex
+	batches []string
+	docs    map[string]database.Result
+	fails   int
+	block   chan struct{}
+}
+
+func (f *batchIndex) AddDocumentsWithContext(_ context.Context, docs interface{}, _ ...string) (*meili.TaskInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := make([]string, 0)
+	for _, doc := range docs.([]*database.Result) {
+		id := keyString((*doc)["id"])
+		ids = append(ids, id)
+
+		if f.docs == nil {
+			f.docs = make(map[string]database.Result)
+		}
+		f.docs[id] = *doc
+	}
+	f.batches = append(f.batches, fmt.Sprintf("replace %v", ids))
+	return &meili.TaskInfo{}, nil
+}
+
+func (f *batchIndex) UpdateDocumentsWithContext(_ context.Context, docs interface{}, _ ...string) (*meili.TaskInfo, error) {
+	if f.block != nil {
+		<-f.block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fails > 0 {
+		f.fails--
+		return nil, errors.New("unavailable")
+	}
+
+	ids := make([]string, 0)
+	for _, doc := range docs.([]*database.Result) {
+		id := keyString((*doc)["id"])
+		ids = append(ids, id)
+
+		if f.docs == nil {
+			f.docs = make(map[string]database.Result)
+		}
+		merged := make(database.Result)
+		for k, v := range f.docs[id] {
+			merged[k] = v
+		}
+		for k, v := range *doc {
+			merged[k] = v
+		}
+		f.docs[id] = merged
+	}
+	f.batches = append(f.batches, fmt.Sprintf("upsert %v", ids))
+	return &meili.TaskInfo{}, nil
+}
+
+func (f *batchIndex) setFails(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fails = n
+}
+
+func (f *batchIndex) DeleteDocumentsWithContext(_ context.Context, ids []string) (*meili.TaskInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.batches = append(f.batches, fmt.Sprintf("delete %v", ids))
+	return &meili.TaskInfo{}, nil
+}
+
+func newTestBatcher(t *testing.T, size int, window time.Duration) (*batchers, *indexBatcher, *batchIndex) {
+	t.Helper()
+
+	idx := new(batchIndex)
+	bs := &batchers{size: size, window: window}
+	b := bs.get(context.Background(), idx, &config.IndexConfig{IndexName: "idx1", PrimaryKey: "id"},
+		func(context.Context, *meili.TaskInfo) error { return nil }, logger.DefaultLogger)
+	b.retryBackoff = time.Millisecond
+
+	return bs, b, idx
+}
+
+func Test_IndexBatcher(t *testing.T) {
+	doc := func(id int) *database.Result {
+		return &database.Result{"id": id}
+	}
+
+	tests := []struct {
+		Name     string
+		Size     int
+		Writes   func(b *indexBatcher)
+		Excepted []string
+	}{
+		{
+			Name: "size",
+			Size: 2,
+			Writes: func(b *indexBatcher) {
+				b.Upsert([]*database.Result{doc(1)})
+				b.Upsert([]*database.Result{doc(2), doc(3)})
+				b.Upsert([]*database.Result{doc(4)})
+			},
+			Excepted: []string{"upsert [1 2 3]", "upsert [4]"},
+		},
+		{
+			Name: "order of kinds",
+			Size: 100,
+			Writes: func(b *indexBatcher) {
+				b.Upsert([]*database.Result{doc(1), doc(2)})
+				b.Delete("1")
+				b.Delete("3")
+				b.Upsert([]*database.Result{doc(1)})
+			},
+			Excepted: []string{"upsert [1 2]", "delete [1 3]", "upsert [1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			bs, b, idx := newTestBatcher(t, tt.Size, time.Hour)
+
+			tt.Writes(b)
+			bs.Close()
+
+			assert.Equal(t, tt.Excepted, idx.batches)
+		})
+	}
+}
+
+func Test_IndexBatcherReplace(t *testing.T) {
+	bs, b, idx := newTestBatcher(t, 100, time.Hour)
+
+	b.Replace([]*database.Result{{"id": 1, "title": "a", "tag": "b"}})
+	b.Upsert([]*database.Result{{"id": 1, "views": 2}})
+
+	// field removed in source is removed by replace
+	b.Replace([]*database.Result{{"id": 1, "title": "c"}})
+	bs.Close()
+
+	assert.Equal(t, []string{"replace [1]", "upsert [1]", "replace [1]"}, idx.batches)
+	assert.Equal(t, database.Result{"id": 1, "title": "c"}, idx.docs["1"])
+}
+
+func Test_IndexBatcherShared(t *testing.T) {
+	des := &config.IndexConfig{IndexName: "people", PrimaryKey: "id"}
+
+	bs := &batchers{size: 100, window: time.Hour}
+	bs.configure(nil, []task{{col: "users", des: des}, {col: "admins", des: des}})
+
+	idx := new(batchIndex)
+	b := bs.get(context.Background(), idx, des, func(context.Context, *meili.TaskInfo) error { return nil }, logger.DefaultLogger)
+
+	// documents of shared index are merged, so fields of other sources are kept
+	b.Replace([]*database.Result{{"id": 1, "role": "admin"}})
+	b.Replace([]*database.Result{{"id": 1, "name": "foo"}})
+	bs.Close()
+
+	assert.Equal(t, database.Result{"id": 1, "role": "admin", "name": "foo"}, idx.docs["1"])
+}
+
+func Test_IndexBatcherWait(t *testing.T) {
+	bs, b, idx := newTestBatcher(t, 100, time.Hour)
+	defer bs.Close()
+
+	b.Upsert([]*database.Result{{"id": 1, "title": "a"}})
+	b.Delete("2")
+
+	doc, ok := b.Pending("1")
+	require.True(t, ok)
+	assert.Equal(t, database.Result{"id": 1, "title": "a"}, doc)
+
+	doc, ok = b.Pending("2")
+	assert.True(t, ok)
+	assert.Nil(t, doc)
+
+	// wait doesn't wait for window
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, b.Delete("3").Wait(ctx))
+
+	assert.Equal(t, []string{"upsert [1]", "delete [2 3]"}, idx.batches)
+
+	_, ok = b.Pending("3")
+	assert.False(t, ok)
+}
+
+func Test_IndexBatcherRetry(t *testing.T) {
+	bs, b, idx := newTestBatcher(t, 100, time.Hour)
+	defer bs.Close()
+
+	idx.setFails(1)
+
+	notified := make(chan error, 1)
+	w := b.Upsert([]*database.Result{{"id": 1}})
+	w.Notify(func(err error) {
+		notified <- err
+	})
+
+	require.NoError(t, w.Wait(context.Background()))
+	assert.NoError(t, <-notified)
+	assert.Equal(t, []string{"upsert [1]"}, idx.batches)
+
+	// batch which fails every attempt reports error to its writes
+	idx.setFails(_batchAttempts)
+	assert.Error(t, b.Upsert([]*database.Result{{"id": 2}}).Wait(context.Background()))
+}
+
+func Test_IndexBatcherNotBlocked(t *testing.T) {
+	block := make(chan struct{})
+	bs, b, idx := newTestBatcher(t, 1, time.Hour)
+	idx.block = block
+
+	// writers don't wait for meilisearch while their batches are queued
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= _batchQueueSize; i++ {
+			b.Upsert([]*database.Result{{"id": i}})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writer is blocked by submit of batch")
+	}
+
+	close(idx.block)
+	bs.Close()
+
+	assert.Len(t, idx.batches, _batchQueueSize)
+}
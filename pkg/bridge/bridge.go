@@ -2,6 +2,7 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -11,14 +12,28 @@ import (
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/database"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
 )
 
+// New connects to database of every bridge, executors are owned by Bridge
+// and released on Close.
 func New(
+	ctx context.Context,
 	bridges []*config.Bridge,
 	triggerCfg *config.TriggerSync,
 	log logger.Logger,
-) *Bridge {
-	return newBridge(bridges, triggerCfg, log)
+) (*Bridge, error) {
+	b := newBridge(bridges, triggerCfg, log)
+
+	for _, bridge := range bridges {
+		if err := database.AddEngine(ctx, bridge.Name, bridge.Database, log); err != nil {
+			_ = b.Close()
+			return nil, fmt.Errorf("failed to connect database of bridge %s: %w", bridge.Name, err)
+		}
+		b.engines = append(b.engines, bridge.Name)
+	}
+
+	return b, nil
 }
 
 func newBridge(
@@ -30,12 +45,13 @@ func newBridge(
 		log:        log,
 		bridges:    bridges,
 		triggerCfg: triggerCfg,
+		stores:     make(map[string]store.Store),
 	}
 
 	return b
 }
 
-func (b *Bridge) Sync(ctx context.Context) error {
+func (b *Bridge) Sync(ctx context.Context, opts SyncOptions) error {
 	var wg sync.WaitGroup
 
 	syncer, err := b.initSyncers(ctx)
@@ -47,7 +63,7 @@ func (b *Bridge) Sync(ctx context.Context) error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			s.OnDemand(ctx)
+			s.OnDemand(ctx, opts)
 			b.log.InfoContext(ctx, fmt.Sprintf("started on demand sync bridge %s", s.Name()))
 		}()
 	}
@@ -58,7 +74,7 @@ func (b *Bridge) Sync(ctx context.Context) error {
 	return nil
 }
 
-func (b *Bridge) BulkSync(ctx context.Context, isContinue bool) error {
+func (b *Bridge) BulkSync(ctx context.Context, opts BulkOptions) error {
 	var wg sync.WaitGroup
 
 	syncer, err := b.initSyncers(ctx)
@@ -71,7 +87,7 @@ func (b *Bridge) BulkSync(ctx context.Context, isContinue bool) error {
 		go func() {
 			defer wg.Done()
 			b.log.InfoContext(ctx, fmt.Sprintf("starting bulk sync bridge %s", s.Name()))
-			s.Bulk(ctx, isContinue)
+			s.Bulk(ctx, opts)
 		}()
 	}
 
@@ -81,6 +97,40 @@ func (b *Bridge) BulkSync(ctx context.Context, isContinue bool) error {
 	return nil
 }
 
+// Reconcile deletes documents of indexes which no longer exist in source,
+// with dryRun orphan documents are only reported.
+func (b *Bridge) Reconcile(ctx context.Context, dryRun bool) error {
+	var wg sync.WaitGroup
+
+	syncer, err := b.initSyncers(ctx)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, len(syncer))
+
+	for _, s := range syncer {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.log.InfoContext(ctx, fmt.Sprintf("starting reconcile bridge %s", s.Name()))
+			if err := s.Reconcile(ctx, dryRun); err != nil {
+				errCh <- fmt.Errorf("bridge %s: %w", s.Name(), err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	errs := make([]error, 0)
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
 func (b *Bridge) TriggerSync(ctx context.Context) error {
 	b.mux = http.NewServeMux()
 
@@ -113,12 +163,24 @@ func (b *Bridge) initSyncers(ctx context.Context) ([]Syncer, error) {
 	syncer := make([]Syncer, 0)
 
 	for _, bridge := range b.bridges {
+		tasks := newTasks(bridge.IndexMap)
+
+		if err := loadScripts(tasks); err != nil {
+			return nil, err
+		}
+
+		// index of many sources has one trigger webhook
+		indexes := make([]string, 0, len(tasks))
+		for _, g := range groupTasks(tasks) {
+			indexes = append(indexes, g[0].des.IndexName)
+		}
+
 		switch bridge.Database.Engine {
 		case config.MONGO:
 			mgo := new(mongo)
 			mgo.name = bridge.Name
-			mgo.executor = database.GetEngine[database.MongoExecutor](config.MONGO)
-			mgo.indexMap = bridge.IndexMap
+			mgo.executor = database.GetEngine[database.MongoExecutor](bridge.Name)
+			mgo.tasks = tasks
 			mgo.log = b.log
 
 			m, err := meilisearch.New(ctx, bridge.Meilisearch.APIURL, bridge.Meilisearch.APIKey, b.log)
@@ -126,21 +188,37 @@ func (b *Bridge) initSyncers(ctx context.Context) ([]Syncer, error) {
 				return nil, err
 			}
 			mgo.meili = m
+			mgo.batchers.configure(bridge.Meilisearch.Batch, tasks)
+
+			st, err := b.openStore(bridge)
+			if err != nil {
+				return nil, err
+			}
+
+			if bridge.Storage != nil {
+				mgo.checkpoint = newCheckpoint(st, b.log)
+			}
 
 			if b.mux != nil {
-				mgo.queue = newQueue(b.log)
+				mgo.queue = newQueue(st, b.triggerCfg.Retry, b.log)
 				mgo.triggerToken = b.triggerCfg.Token
 
+				batchPattern := fmt.Sprintf(_batchPattern, bridge.Name)
+				b.mux.HandleFunc(batchPattern, mgo.BatchTrigger())
+				b.log.Info("add batch trigger webhook", "bridge", bridge.Name, "pattern", batchPattern)
+
 				go func() {
 					mgo.queue.Process(ctx, mgo.processTrigger)
 				}()
 
-				for col, idx := range bridge.IndexMap {
-					mgo.executor.AddCollection(col.GetView())
-					pattern := fmt.Sprintf("/%s/%s", bridge.Name, idx.IndexName)
-					b.mux.HandleFunc(pattern, mgo.Trigger())
-					b.log.Info(fmt.Sprintf("add trigger webhook for %s", idx.IndexName), "pattern", pattern)
+				for _, t := range tasks {
+					mgo.executor.AddCollection(t.col.GetView())
+				}
 
+				for _, index := range indexes {
+					pattern := fmt.Sprintf("/%s/%s", bridge.Name, index)
+					b.mux.HandleFunc(pattern, mgo.Trigger())
+					b.log.Info(fmt.Sprintf("add trigger webhook for %s", index), "pattern", pattern)
 				}
 			}
 
@@ -148,8 +226,8 @@ func (b *Bridge) initSyncers(ctx context.Context) ([]Syncer, error) {
 		case config.POSTGRES, config.MYSQL:
 			sq := new(sql)
 			sq.name = bridge.Name
-			sq.executor = database.GetEngine[database.SQLExecutor](bridge.Database.Engine)
-			sq.indexMap = bridge.IndexMap
+			sq.executor = database.GetEngine[database.SQLExecutor](bridge.Name)
+			sq.tasks = tasks
 			sq.log = b.log
 
 			m, err := meilisearch.New(ctx, bridge.Meilisearch.APIURL, bridge.Meilisearch.APIKey, b.log)
@@ -157,19 +235,33 @@ func (b *Bridge) initSyncers(ctx context.Context) ([]Syncer, error) {
 				return nil, err
 			}
 			sq.meili = m
+			sq.batchers.configure(bridge.Meilisearch.Batch, tasks)
+
+			st, err := b.openStore(bridge)
+			if err != nil {
+				return nil, err
+			}
+
+			if bridge.Storage != nil {
+				sq.checkpoint = newCheckpoint(st, b.log)
+			}
 
 			if b.mux != nil {
-				sq.queue = newQueue(b.log)
+				sq.queue = newQueue(st, b.triggerCfg.Retry, b.log)
 				sq.triggerToken = b.triggerCfg.Token
 
+				batchPattern := fmt.Sprintf(_batchPattern, bridge.Name)
+				b.mux.HandleFunc(batchPattern, sq.BatchTrigger())
+				b.log.Info("add batch trigger webhook", "bridge", bridge.Name, "pattern", batchPattern)
+
 				go func() {
 					sq.queue.Process(ctx, sq.processTrigger)
 				}()
 
-				for _, idx := range bridge.IndexMap {
-					pattern := fmt.Sprintf("/%s/%s", bridge.Name, idx.IndexName)
+				for _, index := range indexes {
+					pattern := fmt.Sprintf("/%s/%s", bridge.Name, index)
 					b.mux.HandleFunc(pattern, sq.Trigger())
-					b.log.Info(fmt.Sprintf("add trigger webhook for %s", idx.IndexName), "pattern", pattern)
+					b.log.Info(fmt.Sprintf("add trigger webhook for %s", index), "pattern", pattern)
 				}
 			}
 
@@ -179,3 +271,45 @@ func (b *Bridge) initSyncers(ctx context.Context) ([]Syncer, error) {
 
 	return syncer, nil
 }
+
+// Close releases resources owned by bridge.
+func (b *Bridge) Close() error {
+	var errs []error
+
+	for name, st := range b.stores {
+		if err := st.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close storage of bridge %s: %w", name, err))
+		}
+		delete(b.stores, name)
+	}
+
+	for _, name := range b.engines {
+		if err := database.RemoveEngine(name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database of bridge %s: %w", name, err))
+		}
+	}
+	b.engines = nil
+
+	return errors.Join(errs...)
+}
+
+// openStore opens storage of bridge, bridges without storage get in-memory store.
+func (b *Bridge) openStore(bridge *config.Bridge) (store.Store, error) {
+	if st, ok := b.stores[bridge.Name]; ok {
+		return st, nil
+	}
+
+	if bridge.Storage == nil {
+		st := store.NewMemory()
+		b.stores[bridge.Name] = st
+		return st, nil
+	}
+
+	st, err := store.New(bridge.Storage.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage of bridge %s: %w", bridge.Name, err)
+	}
+	b.stores[bridge.Name] = st
+
+	return st, nil
+}
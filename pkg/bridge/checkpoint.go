@@ -0,0 +1,189 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	_resumeTokenBucket  = "resume_tokens"
+	_watermarkBucket    = "watermarks"
+	_snapshotBucket     = "snapshots"
+	_checkpointInterval = time.Second
+)
+
+// checkpoint keeps latest change stream resume tokens in memory and flushes
+// them to store periodically, also keeps incremental bulk watermarks.
+// nil checkpoint disables resuming.
+type checkpoint struct {
+	store  store.Store
+	log    logger.Logger
+	mu     sync.Mutex
+	tokens map[string][]byte
+}
+
+func newCheckpoint(s store.Store, log logger.Logger) *checkpoint {
+	return &checkpoint{
+		store:  s,
+		log:    log,
+		tokens: make(map[string][]byte),
+	}
+}
+
+func checkpointKey(t task) string {
+	return t.col.String() + "/" + t.des.IndexName
+}
+
+func (c *checkpoint) Load(key string) []byte {
+	if c == nil {
+		return nil
+	}
+
+	token, err := c.store.Get(_resumeTokenBucket, key)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			c.log.Error("failed to load resume token", "key", key, "err", err)
+		}
+		return nil
+	}
+
+	return token
+}
+
+func (c *checkpoint) Save(key string, token []byte) {
+	if c == nil || len(token) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+}
+
+// Run flushes tokens every interval until context is done.
+func (c *checkpoint) Run(ctx context.Context) {
+	ticker := time.NewTicker(_checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush()
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+func (c *checkpoint) flush() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	tokens := c.tokens
+	c.tokens = make(map[string][]byte)
+	c.mu.Unlock()
+
+	for key, token := range tokens {
+		if err := c.store.Put(_resumeTokenBucket, key, token); err != nil {
+			c.log.Error("failed to save resume token", "key", key, "err", err)
+		}
+	}
+}
+
+// LoadWatermark returns high-water mark of last successful incremental bulk,
+// nil if there is no previous run.
+func (c *checkpoint) LoadWatermark(key string) (any, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	data, err := c.store.Get(_watermarkBucket, key)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var w watermark
+	if err := bson.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+
+	if dt, ok := w.Value.(primitive.DateTime); ok {
+		return dt.Time().UTC(), nil
+	}
+
+	return w.Value, nil
+}
+
+func (c *checkpoint) SaveWatermark(key string, value any) error {
+	if c == nil || value == nil {
+		return nil
+	}
+
+	data, err := bson.Marshal(watermark{Value: value})
+	if err != nil {
+		return err
+	}
+
+	return c.store.Put(_watermarkBucket, key, data)
+}
+
+// LoadSnapshot returns operation time of finished snapshot of key, ok is false
+// if snapshot isn't loaded yet.
+func (c *checkpoint) LoadSnapshot(key string) (primitive.Timestamp, bool) {
+	if c == nil {
+		return primitive.Timestamp{}, false
+	}
+
+	data, err := c.store.Get(_snapshotBucket, key)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			c.log.Error("failed to load snapshot", "key", key, "err", err)
+		}
+		return primitive.Timestamp{}, false
+	}
+
+	var m snapshotMark
+	if err := bson.Unmarshal(data, &m); err != nil {
+		c.log.Error("failed to load snapshot", "key", key, "err", err)
+		return primitive.Timestamp{}, false
+	}
+
+	return m.At, true
+}
+
+// SaveSnapshot marks snapshot of key as finished at operation time, so it isn't
+// loaded again if bridge stops before first resume token is saved.
+func (c *checkpoint) SaveSnapshot(key string, ts primitive.Timestamp) error {
+	if c == nil {
+		return nil
+	}
+
+	data, err := bson.Marshal(snapshotMark{At: ts})
+	if err != nil {
+		return err
+	}
+
+	return c.store.Put(_snapshotBucket, key, data)
+}
+
+type snapshotMark struct {
+	At primitive.Timestamp `bson:"at"`
+}
+
+// watermark is bson encoded to keep type of value, e.g. time or int.
+type watermark struct {
+	Value any `bson:"value"`
+}
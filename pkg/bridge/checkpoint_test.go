@@ -0,0 +1,167 @@
+package bridge
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_CheckpointWatermark(t *testing.T) {
+	st, err := store.New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	cp := newCheckpoint(st, logger.DefaultLogger)
+
+	tests := []struct {
+		Name     string
+		Value    any
+		Excepted any
+	}{
+		{
+			Name:     "time",
+			Value:    time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+			Excepted: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			Name:     "int",
+			Value:    int64(42),
+			Excepted: int64(42),
+		},
+		{
+			Name:     "string",
+			Value:    "2024-05-01",
+			Excepted: "2024-05-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			v, err := cp.LoadWatermark(tt.Name)
+			require.NoError(t, err)
+			assert.Nil(t, v)
+
+			require.NoError(t, cp.SaveWatermark(tt.Name, tt.Value))
+
+			v, err = cp.LoadWatermark(tt.Name)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, v)
+		})
+	}
+}
+
+func Test_StreamStart(t *testing.T) {
+	st, err := store.New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	cp := newCheckpoint(st, logger.DefaultLogger)
+
+	resumed := task{col: "users", des: &config.IndexConfig{IndexName: "users"}}
+	fresh := task{col: "orders", des: &config.IndexConfig{IndexName: "orders"}}
+	other := task{col: "items", des: &config.IndexConfig{IndexName: "items"}}
+
+	cp.Save(checkpointKey(resumed), []byte("token"))
+	cp.flush()
+
+	ts := primitive.Timestamp{T: 1714559400, I: 1}
+	m := &mongo{checkpoint: cp, startAt: map[string]primitive.Timestamp{
+		checkpointKey(resumed): ts,
+		checkpointKey(fresh):   ts,
+	}}
+
+	tests := []struct {
+		Name     string
+		Task     task
+		Key      string
+		Excepted database.StreamStart
+	}{
+		{
+			Name:     "resume token",
+			Task:     resumed,
+			Key:      checkpointKey(resumed),
+			Excepted: database.StreamStart{ResumeToken: []byte("token"), OperationTime: &ts},
+		},
+		{
+			Name:     "snapshot",
+			Task:     fresh,
+			Key:      checkpointKey(fresh),
+			Excepted: database.StreamStart{OperationTime: &ts},
+		},
+		{
+			Name:     "dependency of snapshot",
+			Task:     fresh,
+			Key:      checkpointKey(fresh) + "/companies",
+			Excepted: database.StreamStart{OperationTime: &ts},
+		},
+		{
+			Name:     "without snapshot",
+			Task:     other,
+			Key:      checkpointKey(other),
+			Excepted: database.StreamStart{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, m.streamStart(tt.Task, tt.Key))
+		})
+	}
+}
+
+func Test_SnapshotFinished(t *testing.T) {
+	st, err := store.New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	cp := newCheckpoint(st, logger.DefaultLogger)
+
+	resumed := task{col: "users", des: &config.IndexConfig{IndexName: "users"}}
+	loaded := task{col: "orders", des: &config.IndexConfig{IndexName: "orders"}}
+
+	cp.Save(checkpointKey(resumed), []byte("token"))
+	cp.flush()
+
+	_, ok := cp.LoadSnapshot(checkpointKey(loaded))
+	assert.False(t, ok)
+
+	ts := primitive.Timestamp{T: 1714559400, I: 1}
+	require.NoError(t, cp.SaveSnapshot(checkpointKey(loaded), ts))
+
+	// snapshot which is finished before restart isn't loaded again, executor
+	// isn't set, so any bulk fails the test
+	m := &mongo{checkpoint: cp, tasks: []task{resumed, loaded}, log: logger.DefaultLogger}
+	require.NoError(t, m.snapshot(context.Background()))
+
+	assert.Equal(t, map[string]primitive.Timestamp{checkpointKey(loaded): ts}, m.startAt)
+}
+
+type fakeSQLExecutor struct {
+	database.SQLExecutor
+}
+
+func (f *fakeSQLExecutor) Watcher(context.Context, string, database.Checkpoint) (<-chan func() (database.WatcherType, database.WatchResult), error) {
+	return make(chan func() (database.WatcherType, database.WatchResult)), nil
+}
+
+func Test_SQLSnapshotFinished(t *testing.T) {
+	cp := newCheckpoint(store.NewMemory(), logger.DefaultLogger)
+
+	loaded := task{col: "orders", des: &config.IndexConfig{IndexName: "orders"}}
+	require.NoError(t, cp.SaveSnapshot(checkpointKey(loaded), primitive.Timestamp{T: 1714559400}))
+
+	// meili isn't set, so any bulk fails the test
+	s := &sql{executor: &fakeSQLExecutor{}, checkpoint: cp, tasks: []task{loaded}, log: logger.DefaultLogger}
+	require.NoError(t, s.snapshot(context.Background()))
+
+	assert.Contains(t, s.watches, checkpointKey(loaded))
+}
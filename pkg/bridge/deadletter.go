@@ -0,0 +1,102 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"github.com/Ja7ad/meilibridge/pkg/types"
+)
+
+const _deadLetterBucket = "dead_letters"
+
+// DeadLetter is trigger item which failed after max attempts or can't be retried.
+type DeadLetter struct {
+	ID       string                   `json:"id"`
+	Item     types.TriggerRequestBody `json:"item"`
+	Attempts int                      `json:"attempts"`
+	Error    string                   `json:"error"`
+	FailedAt time.Time                `json:"failed_at"`
+}
+
+func addDeadLetter(st store.Store, entry queueEntry, cause error) error {
+	data, err := json.Marshal(DeadLetter{
+		Item:     entry.Item,
+		Attempts: entry.Attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = st.Append(_deadLetterBucket, data)
+	return err
+}
+
+// ListDeadLetters returns dead letters of bridge storage in order of failure.
+func ListDeadLetters(st store.Store) ([]*DeadLetter, error) {
+	letters := make([]*DeadLetter, 0)
+
+	err := st.ForEach(_deadLetterBucket, func(key string, value []byte) error {
+		dl, err := decodeDeadLetter(key, value)
+		if err != nil {
+			return err
+		}
+		letters = append(letters, dl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return letters, nil
+}
+
+func GetDeadLetter(st store.Store, id string) (*DeadLetter, error) {
+	value, err := st.Get(_deadLetterBucket, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+		}
+		return nil, err
+	}
+
+	return decodeDeadLetter(id, value)
+}
+
+// ReplayDeadLetter moves dead letter back to trigger queue with reset attempts,
+// it's processed by trigger sync. Dead letter is moved in one write, so it's
+// never lost or queued twice.
+func ReplayDeadLetter(st store.Store, id string) error {
+	dl, err := GetDeadLetter(st, id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(queueEntry{Item: dl.Item})
+	if err != nil {
+		return err
+	}
+
+	if _, err := st.Move(_deadLetterBucket, id, _queueBucket, data); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func decodeDeadLetter(key string, value []byte) (*DeadLetter, error) {
+	dl := new(DeadLetter)
+	if err := json.Unmarshal(value, dl); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letter %s: %w", key, err)
+	}
+	dl.ID = key
+
+	return dl, nil
+}
@@ -0,0 +1,229 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	meili "github.com/meilisearch/meilisearch-go"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// watchDependency watches dependency collection of index, every changed dependency
+// document reindexes documents of source which reference it.
+func (m *mongo) watchDependency(
+	ctx context.Context,
+	idx meili.IndexManager,
+	t task,
+	dep *config.Dependency,
+	source string,
+) {
+	m.executor.AddCollection(dep.Collection)
+
+	key := checkpointKey(t) + "/" + dep.Collection
+
+	// old foreign field of changed or deleted document is read from its pre-image
+	start := m.streamStart(t, key)
+	start.PreImage = dep.ForeignField != "_id"
+
+	watch, err := m.executor.Watcher(ctx, dep.Collection, start, nil)
+	if err != nil && start.PreImage && !errors.Is(err, database.ErrResumeTokenLost) {
+		m.log.Warn("pre-images of dependency aren't supported, dependents of old values aren't reindexed",
+			"collection", dep.Collection, "index", t.des.IndexName, "err", err)
+
+		start.PreImage = false
+		watch, err = m.executor.Watcher(ctx, dep.Collection, start, nil)
+	}
+	if errors.Is(err, database.ErrResumeTokenLost) {
+		m.log.Warn("change stream of dependency can't resume, changes until now are skipped",
+			"collection", dep.Collection, "index", t.des.IndexName, "err", err)
+
+		watch, err = m.executor.Watcher(ctx, dep.Collection, database.StreamStart{PreImage: start.PreImage}, nil)
+	}
+	if err != nil {
+		m.log.Error(fmt.Sprintf("failed to watch dependency %s of index %s", dep.Collection, t.des.IndexName),
+			"err", err.Error())
+		return
+	}
+
+	// resume token isn't saved past event which isn't written
+	progress := database.NewProgress(func(token []byte) {
+		m.checkpoint.Save(key, token)
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-progress.Failed():
+			// resume token can't pass failed event, stream resumes from it after restart
+			m.log.Error(fmt.Sprintf("change stream of dependency %s of index %s stopped", dep.Collection, t.des.IndexName),
+				"err", progress.Err().Error())
+			return
+		case w, ok := <-watch:
+			if !ok {
+				return
+			}
+
+			_, res := w()
+			ack := progress.Add(res.ResumeToken, 1)
+
+			m.handleDependencyEvent(ctx, idx, t, dep, w, source).Notify(func(err error) {
+				if err != nil {
+					m.log.Error(err.Error())
+				}
+				ack(err)
+			})
+		}
+	}
+}
+
+func (m *mongo) handleDependencyEvent(
+	ctx context.Context,
+	idx meili.IndexManager,
+	t task,
+	dep *config.Dependency,
+	w func() (database.WatcherType, database.WatchResult),
+	source string,
+) *batchWrite {
+	wType, res := w()
+
+	values, ok, err := m.dependencyValues(ctx, dep, wType, res)
+	if err != nil {
+		return doneWrite(fmt.Errorf("failed to find dependency %s of index %s: %w", dep.Collection, t.des.IndexName, err))
+	}
+
+	if !ok {
+		m.log.Warn(fmt.Sprintf("%s of dependency document %s is unknown", dep.ForeignField, keyString(res.DocumentId)),
+			"collection", dep.Collection, "index", t.des.IndexName, "event", wType)
+		return doneWrite(nil)
+	}
+
+	if len(values) == 0 {
+		return doneWrite(nil)
+	}
+
+	cur, err := m.findDependents(ctx, t, dep, values, source)
+	if err != nil {
+		return doneWrite(fmt.Errorf("failed to find documents of dependency %s in %s: %w", dep.Collection, source, err))
+	}
+
+	// dependents are written page by page, batcher blocks while it's behind
+	var (
+		writes []*batchWrite
+		count  int
+	)
+
+	b := m.batcher(ctx, idx, t)
+	for cur.Next(ctx) {
+		results, err := cur.Result()
+		if err != nil {
+			break
+		}
+
+		docs, err := mapDocuments(ctx, results, t.des)
+		if err != nil {
+			return joinWrites(append(writes,
+				doneWrite(fmt.Errorf("failed to map document of index %s: %w", t.des.IndexName, err)))...)
+		}
+
+		writes = append(writes, b.Replace(docs))
+		count += len(docs)
+	}
+
+	if _, err := cur.Result(); err != nil {
+		return joinWrites(append(writes,
+			doneWrite(fmt.Errorf("failed to find documents of dependency %s in %s: %w", dep.Collection, source, err)))...)
+	}
+
+	if count > 0 {
+		m.log.InfoContext(ctx, fmt.Sprintf("reindex %d documents of dependency %s", count, keyString(res.DocumentId)),
+			"collection", dep.Collection, "index", t.des.IndexName)
+	}
+
+	return joinWrites(writes...)
+}
+
+// dependencyValues returns old and new foreign field of changed dependency
+// document, old value is read from pre-image of event. ok is false if value
+// can't be known like foreign field of deleted document without pre-image.
+func (m *mongo) dependencyValues(
+	ctx context.Context,
+	dep *config.Dependency,
+	wType database.WatcherType,
+	res database.WatchResult,
+) ([]any, bool, error) {
+	if dep.ForeignField == "_id" {
+		return []any{res.DocumentId}, true, nil
+	}
+
+	var values []any
+	add := func(v any) {
+		for _, value := range values {
+			if keyString(value) == keyString(v) {
+				return
+			}
+		}
+		values = append(values, v)
+	}
+
+	if v, ok := res.Before[dep.ForeignField]; ok {
+		add(v)
+	}
+
+	switch wType {
+	case database.OnInsert, database.OnReplace:
+		if v, ok := res.Document[dep.ForeignField]; ok {
+			add(v)
+		}
+	case database.OnUpdate:
+		if v, ok := res.Update.UpdateFields[dep.ForeignField]; ok {
+			add(v)
+			break
+		}
+
+		// value isn't changed, it's in pre-image if there is one
+		if res.Before != nil {
+			break
+		}
+
+		// update event doesn't have full document
+		doc, err := m.executor.FindOne(ctx, bson.D{{Key: "_id", Value: res.DocumentId}}, dep.Collection)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if v, ok := doc[dep.ForeignField]; ok {
+			add(v)
+		}
+	case database.OnDelete:
+		if res.Before == nil {
+			return nil, false, nil
+		}
+	}
+
+	return values, true, nil
+}
+
+// findDependents returns cursor of documents of source which local field
+// references one of values.
+func (m *mongo) findDependents(
+	ctx context.Context,
+	t task,
+	dep *config.Dependency,
+	values []any,
+	source string,
+) (database.Cursor, error) {
+	filter := database.MatchFilter(
+		bson.D{{Key: dep.LocalField, Value: bson.D{{Key: "$in", Value: values}}}},
+		mongoFilter(t.des),
+	)
+
+	if pipeline := mongoPipeline(t.des); pipeline != nil {
+		return m.executor.AggregateLimit(ctx, _bulkLimit, source, nil, filter, pipeline)
+	}
+
+	return m.executor.FindLimit(ctx, _bulkLimit, source, nil, filter)
+}
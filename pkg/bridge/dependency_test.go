@@ -0,0 +1,173 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeMongoExecutor struct {
+	database.MongoExecutor
+	docs map[string][]database.Result
+}
+
+func (f *fakeMongoExecutor) FindOne(_ context.Context, filter interface{}, col string) (database.Result, error) {
+	id := filter.(primitive.D)[0].Value
+	for _, doc := range f.docs[col] {
+		if doc["_id"] == id {
+			return doc, nil
+		}
+	}
+	return nil, nil
+}
+
+// FindLimit returns documents which match {field: {$in: values}} filter as one page.
+func (f *fakeMongoExecutor) FindLimit(_ context.Context, _ int64, col string, _ *database.Watermark, filter any) (database.Cursor, error) {
+	cond := filter.(bson.D)[0]
+	values := cond.Value.(bson.D)[0].Value.([]any)
+
+	res := make([]*database.Result, 0)
+	for _, doc := range f.docs[col] {
+		for _, v := range values {
+			if doc[cond.Key] == v {
+				d := doc
+				res = append(res, &d)
+			}
+		}
+	}
+	return &fakeCursor{pages: [][]*database.Result{res}}, nil
+}
+
+type fakeCursor struct {
+	pages [][]*database.Result
+	cur   []*database.Result
+}
+
+func (c *fakeCursor) Next(_ context.Context) bool {
+	if len(c.pages) == 0 || len(c.pages[0]) == 0 {
+		return false
+	}
+	c.cur, c.pages = c.pages[0], c.pages[1:]
+	return true
+}
+
+func (c *fakeCursor) Result() ([]*database.Result, error) {
+	return c.cur, nil
+}
+
+func Test_HandleDependencyEvent(t *testing.T) {
+	companyID := primitive.NewObjectID()
+
+	exec := &fakeMongoExecutor{docs: map[string][]database.Result{
+		"companies": {{"_id": companyID, "code": "acme", "name": "Acme"}},
+		"users_view": {
+			{"_id": "u1", "company_code": "acme", "company": "Acme"},
+			{"_id": "u2", "company_code": "other", "company": "Other"},
+			{"_id": "u3", "company_code": "acme", "company": "Acme"},
+		},
+	}}
+
+	tests := []struct {
+		Name     string
+		Type     database.WatcherType
+		Result   database.WatchResult
+		Excepted []*database.Result
+	}{
+		{
+			Name:   "update without foreign field",
+			Type:   database.OnUpdate,
+			Result: database.WatchResult{DocumentId: companyID},
+			Excepted: []*database.Result{
+				{"id": "u1", "company": "Acme"},
+				{"id": "u3", "company": "Acme"},
+			},
+		},
+		{
+			Name:   "insert",
+			Type:   database.OnInsert,
+			Result: database.WatchResult{DocumentId: companyID, Document: database.Result{"code": "other"}},
+			Excepted: []*database.Result{
+				{"id": "u2", "company": "Other"},
+			},
+		},
+		{
+			Name: "update of foreign field with pre-image",
+			Type: database.OnUpdate,
+			Result: database.WatchResult{
+				DocumentId: companyID,
+				Before:     database.Result{"_id": companyID, "code": "other"},
+				Update: struct {
+					UpdateFields database.Result
+					RemoveFields []string
+				}{UpdateFields: database.Result{"code": "acme"}},
+			},
+			Excepted: []*database.Result{
+				{"id": "u1", "company": "Acme"},
+				{"id": "u2", "company": "Other"},
+				{"id": "u3", "company": "Acme"},
+			},
+		},
+		{
+			Name: "update of foreign field to unknown value with pre-image",
+			Type: database.OnUpdate,
+			Result: database.WatchResult{
+				DocumentId: companyID,
+				Before:     database.Result{"_id": companyID, "code": "other"},
+				Update: struct {
+					UpdateFields database.Result
+					RemoveFields []string
+				}{UpdateFields: database.Result{"code": "none"}},
+			},
+			Excepted: []*database.Result{
+				{"id": "u2", "company": "Other"},
+			},
+		},
+		{
+			Name:     "delete",
+			Type:     database.OnDelete,
+			Result:   database.WatchResult{DocumentId: companyID},
+			Excepted: nil,
+		},
+		{
+			Name: "delete with pre-image",
+			Type: database.OnDelete,
+			Result: database.WatchResult{
+				DocumentId: companyID,
+				Before:     database.Result{"_id": companyID, "code": "other"},
+			},
+			Excepted: []*database.Result{
+				{"id": "u2", "company": "Other"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			idx := &fakeIndex{}
+			m := &mongo{executor: exec, meili: &fakeMeili{idx: idx}, log: logger.DefaultLogger}
+
+			tsk := task{
+				col: "users:users_view",
+				des: &config.IndexConfig{
+					IndexName:  "users",
+					PrimaryKey: "id",
+					Fields:     map[string]string{"_id": "id", "company": ""},
+				},
+			}
+			dep := &config.Dependency{Collection: "companies", LocalField: "company_code", ForeignField: "code"}
+
+			err := m.handleDependencyEvent(context.Background(), idx, tsk, dep, func() (database.WatcherType, database.WatchResult) {
+				return tt.Type, tt.Result
+			}, "users_view").Wait(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, idx.replaced)
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package bridge
+
+import "errors"
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+	errInvalidIndexUID = errors.New("invalid index UID")
+	errAmbiguousIndex  = errors.New("source is required for index of many sources")
+)
@@ -0,0 +1,177 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const _projectionSuffix = "[]"
+
+func isFieldPath(key string) bool {
+	return strings.Contains(key, ".") || strings.HasSuffix(key, _projectionSuffix)
+}
+
+func splitPath(key string) []string {
+	return strings.Split(key, ".")
+}
+
+// lookupPath returns value of nested field, segment with [] suffix is array and
+// rest of path is looked up in every element of it, nested projections are
+// flattened to one array.
+func lookupPath(v any, path []string) (any, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	name, project := strings.CutSuffix(path[0], _projectionSuffix)
+
+	m, ok := asObject(v)
+	if s, isString := v.(string); !ok && isString {
+		m, ok = asObject([]byte(s))
+	}
+	if !ok {
+		return nil, false
+	}
+
+	child, ok := m[name]
+	if !ok {
+		return nil, false
+	}
+
+	if !project {
+		return lookupPath(child, path[1:])
+	}
+
+	arr, ok := asArray(child)
+	if !ok {
+		return nil, false
+	}
+
+	nested := hasProjection(path[1:])
+	values := make([]any, 0, len(arr))
+
+	for _, e := range arr {
+		ev, ok := lookupPath(e, path[1:])
+		if !ok || ev == nil {
+			continue
+		}
+
+		if sub, ok := ev.([]any); ok && nested {
+			values = append(values, sub...)
+			continue
+		}
+		values = append(values, ev)
+	}
+
+	return values, true
+}
+
+func hasProjection(path []string) bool {
+	for _, seg := range path {
+		if strings.HasSuffix(seg, _projectionSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setPath sets value in nested maps of document, maps are created if missing.
+func setPath(doc database.Result, path []string, value any) {
+	m := map[string]any(doc)
+
+	for _, seg := range path[:len(path)-1] {
+		next, ok := m[seg].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[seg] = next
+		}
+		m = next
+	}
+
+	m[path[len(path)-1]] = value
+}
+
+// flattenDocument moves fields of nested objects to top level of document,
+// keys are joined by sep (profile_address_city). Arrays are kept as is.
+func flattenDocument(doc database.Result, sep string) {
+	for k, v := range doc {
+		m, ok := asObject(v)
+		if !ok {
+			continue
+		}
+
+		delete(doc, k)
+		flattenInto(doc, k, m, sep)
+	}
+}
+
+func flattenInto(doc database.Result, prefix string, m map[string]any, sep string) {
+	for k, v := range m {
+		key := prefix + sep + k
+
+		if sub, ok := asObject(v); ok {
+			flattenInto(doc, key, sub, sep)
+			continue
+		}
+		doc[key] = v
+	}
+}
+
+// asObject returns nested document as map, JSON objects of SQL columns are decoded.
+func asObject(v any) (map[string]any, bool) {
+	switch o := v.(type) {
+	case map[string]any:
+		return o, true
+	case database.Result:
+		return o, true
+	case primitive.M:
+		return o, true
+	case primitive.D:
+		m := make(map[string]any, len(o))
+		for _, e := range o {
+			m[e.Key] = e.Value
+		}
+		return m, true
+	case []byte:
+		var m map[string]any
+		if !bytes.HasPrefix(bytes.TrimSpace(o), []byte("{")) || json.Unmarshal(o, &m) != nil {
+			return nil, false
+		}
+		return m, true
+	}
+
+	return nil, false
+}
+
+func asArray(v any) ([]any, bool) {
+	switch a := v.(type) {
+	case []any:
+		return a, true
+	case primitive.A:
+		return a, true
+	case []map[string]any:
+		arr := make([]any, 0, len(a))
+		for _, e := range a {
+			arr = append(arr, e)
+		}
+		return arr, true
+	case []byte:
+		var arr []any
+		if json.Unmarshal(a, &arr) != nil {
+			return nil, false
+		}
+		return arr, true
+	case string:
+		var arr []any
+		if json.Unmarshal([]byte(a), &arr) != nil {
+			return nil, false
+		}
+		return arr, true
+	}
+
+	return nil, false
+}
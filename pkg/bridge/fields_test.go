@@ -0,0 +1,88 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_UpdateItemKeys(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Document database.Result
+		Fields   map[string]string
+		Excepted database.Result
+	}{
+		{
+			Name:     "top level",
+			Document: database.Result{"_id": 1, "name": "foo", "secret": "bar"},
+			Fields:   map[string]string{"_id": "id", "name": ""},
+			Excepted: database.Result{"id": 1, "name": "foo"},
+		},
+		{
+			Name: "dotted path of sub document",
+			Document: database.Result{
+				"id": 1,
+				"profile": primitive.D{
+					{Key: "address", Value: primitive.D{{Key: "city", Value: "Wonderland"}}},
+					{Key: "age", Value: 30},
+				},
+			},
+			Fields:   map[string]string{"id": "", "profile.address.city": "city", "profile.age": ""},
+			Excepted: database.Result{"id": 1, "city": "Wonderland", "profile": map[string]any{"age": 30}},
+		},
+		{
+			Name:     "dotted path of json column",
+			Document: database.Result{"id": 1, "profile": []byte(`{"address": {"city": "Wonderland"}}`)},
+			Fields:   map[string]string{"id": "", "profile.address.city": "city", "profile.address.street": "street"},
+			Excepted: database.Result{"id": 1, "city": "Wonderland"},
+		},
+		{
+			Name: "array projection",
+			Document: database.Result{
+				"id": 1,
+				"orders": primitive.A{
+					primitive.M{"items": primitive.A{primitive.M{"sku": "a"}, primitive.M{"sku": "b"}}},
+					primitive.M{"items": primitive.A{primitive.M{"sku": "c"}}},
+				},
+				"tags": []any{map[string]any{"name": "x"}, map[string]any{"name": "y"}},
+			},
+			Fields:   map[string]string{"id": "", "orders[].items[].sku": "skus", "tags[].name": "tags"},
+			Excepted: database.Result{"id": 1, "skus": []any{"a", "b", "c"}, "tags": []any{"x", "y"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			doc := tt.Document
+			updateItemKeys([]*database.Result{&doc}, tt.Fields)
+			assert.Equal(t, tt.Excepted, doc)
+		})
+	}
+}
+
+func Test_FlattenDocument(t *testing.T) {
+	des := &config.IndexConfig{
+		Flatten: &config.Flatten{Separator: "_"},
+	}
+
+	doc := database.Result{
+		"id":      1,
+		"profile": []byte(`{"age": 30, "address": {"city": "Wonderland"}}`),
+		"meta":    primitive.M{"tags": primitive.A{"a"}},
+	}
+	_, err := mapDocuments(context.Background(), []*database.Result{&doc}, des)
+	require.NoError(t, err)
+
+	assert.Equal(t, database.Result{
+		"id":                   1,
+		"profile_age":          float64(30),
+		"profile_address_city": "Wonderland",
+		"meta_tags":            primitive.A{"a"},
+	}, doc)
+}
@@ -5,16 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Ja7ad/meilibridge/pkg/types"
-	meili "github.com/meilisearch/meilisearch-go"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
 )
 
+// updateItemKeys keeps fields of map and renames them, key of fields can be
+// dotted path of nested field (profile.address.city) or array projection
+// (tags[].name). Dotted path without new name is kept nested.
 func updateItemKeys(results []*database.Result, fields map[string]string) {
 	if fields == nil {
 		return
@@ -22,22 +26,106 @@ func updateItemKeys(results []*database.Result, fields map[string]string) {
 
 	for i := range results {
 		resultMap := *results[i]
-
-		for key := range resultMap {
-			if _, exists := fields[key]; !exists {
-				delete(resultMap, key)
-			}
-		}
+		doc := make(database.Result, len(fields))
 
 		for fk, fv := range fields {
-			if fv != "" {
+			if !isFieldPath(fk) {
 				if value, exists := resultMap[fk]; exists {
-					resultMap[fv] = value
-					delete(resultMap, fk)
+					if fv == "" {
+						fv = fk
+					}
+					doc[fv] = value
 				}
+				continue
+			}
+
+			value, exists := lookupPath(resultMap, splitPath(fk))
+			if !exists {
+				continue
 			}
+
+			if fv != "" {
+				doc[fv] = value
+				continue
+			}
+			setPath(doc, splitPath(fk), value)
+		}
+
+		*results[i] = doc
+	}
+}
+
+// sqlFilter returns filter of index for sql executor, nil if index has no filter.
+func sqlFilter(des *config.IndexConfig) *database.Filter {
+	if des.Filter == nil || des.Filter.SQL == "" {
+		return nil
+	}
+
+	return &database.Filter{Query: des.Filter.SQL, Args: des.Filter.Params}
+}
+
+// sqlSource returns query of index as derived table if index has query source,
+// otherwise table or view is returned as is.
+func sqlSource(table string, des *config.IndexConfig) string {
+	if des.Query == nil {
+		return table
+	}
+
+	return database.Subquery(des.Query.SQL)
+}
+
+// mongoFilter returns filter document of index, nil if index has no filter.
+func mongoFilter(des *config.IndexConfig) any {
+	if des.Filter == nil || len(des.Filter.Mongo) == 0 {
+		return nil
+	}
+
+	return des.Filter.Mongo
+}
+
+// mongoPipeline returns aggregation pipeline of index, nil if documents are read
+// from collection as is.
+func mongoPipeline(des *config.IndexConfig) []any {
+	if len(des.Pipeline) == 0 {
+		return nil
+	}
+
+	pipeline := make([]any, 0, len(des.Pipeline))
+	for _, stage := range des.Pipeline {
+		pipeline = append(pipeline, stage)
+	}
+
+	return pipeline
+}
+
+// inlineDocument returns copy of document body carried by trigger item, ok is
+// false if document must be read from source.
+func inlineDocument(item types.TriggerRequestBody) (database.Result, bool) {
+	if item.Type == types.DELETE || item.Document == nil || item.Document.Body == nil {
+		return nil, false
+	}
+
+	doc := make(database.Result, len(item.Document.Body))
+	for k, v := range item.Document.Body {
+		doc[k] = v
+	}
+
+	return doc, true
+}
+
+// sourcePrimaryKey returns primary key name in source database, primary key of
+// index config maybe renamed by fields map.
+func sourcePrimaryKey(des *config.IndexConfig) string {
+	if des.Query != nil {
+		return des.Query.PrimaryKey
+	}
+
+	for src, dst := range des.Fields {
+		if dst == des.PrimaryKey {
+			return src
 		}
 	}
+	return des.PrimaryKey
 }
 
 func recreateIndex(
@@ -66,6 +154,61 @@ func recreateIndex(
 	return nil
 }
 
+// prepareBulkIndex prepares index for bulk sync and returns name of index which
+// documents should be written to.
+func prepareBulkIndex(
+	ctx context.Context,
+	meili meilisearch.Meilisearch,
+	des *config.IndexConfig,
+	opts BulkOptions,
+) (string, error) {
+	switch {
+	case opts.Continue:
+		if !meili.IsExistsIndex(ctx, des.IndexName) {
+			return "", fmt.Errorf("index %s does not exist for resync", des.IndexName)
+		}
+		return des.IndexName, nil
+	case opts.Swap:
+		tmp := fmt.Sprintf("%s_tmp_%d", des.IndexName, time.Now().Unix())
+		if err := recreateIndex(ctx, tmp, des.PrimaryKey, des.Settings, meili); err != nil {
+			return "", fmt.Errorf("failed to create temporary index: %w", err)
+		}
+		return tmp, nil
+	default:
+		if err := recreateIndex(ctx, des.IndexName, des.PrimaryKey, des.Settings, meili); err != nil {
+			return "", fmt.Errorf("failed to recreate index: %w", err)
+		}
+		return des.IndexName, nil
+	}
+}
+
+// swapIndex swaps live index with filled temporary index and deletes old
+// documents which are moved to temporary index by swap.
+func swapIndex(
+	ctx context.Context,
+	meili meilisearch.Meilisearch,
+	live, tmp, primaryKey string,
+) error {
+	// both indexes must exist for swap
+	if !meili.IsExistsIndex(ctx, live) {
+		if err := meili.CreateIndex(ctx, live, primaryKey); err != nil {
+			return err
+		}
+	}
+
+	if err := meili.SwapIndexes(ctx, live, tmp); err != nil {
+		return fmt.Errorf("failed to swap index %s with %s: %w", live, tmp, err)
+	}
+
+	return meili.DeleteIndex(ctx, tmp)
+}
+
+func dropIndex(ctx context.Context, meili meilisearch.Meilisearch, uid string, log logger.Logger) {
+	if err := meili.DeleteIndex(ctx, uid); err != nil {
+		log.Warn("failed to delete temporary index", "index", uid, "err", err)
+	}
+}
+
 func progressBar(totalItems, totalIndexedItems int64, bridge, col, index string) {
 	percentage := float64(totalIndexedItems) / float64(totalItems) * 100
 	barLength := 50
@@ -116,49 +259,83 @@ func triggerHandler(token string, queue *Queue) http.HandlerFunc {
 			return
 		}
 
-		queue.Add(*b)
+		if err := queue.Add(*b); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		w.WriteHeader(http.StatusAccepted)
 	}
 }
 
-func indexConfigByUID(uid string, indexMap map[config.Collection]*config.IndexConfig) (string, *config.IndexConfig) {
-	for col, idx := range indexMap {
-		if uid == idx.IndexName {
-			return col.GetView(), idx
+// newTasks returns task of every index of collections.
+func newTasks(indexMap map[config.Collection]config.Indexes) []task {
+	tasks := make([]task, 0, len(indexMap))
+	for col, indexes := range indexMap {
+		for _, des := range indexes {
+			tasks = append(tasks, task{col: col, des: des})
 		}
 	}
-	return "", nil
+	return tasks
 }
 
-func processTrigger(
-	ctx context.Context,
-	waitFunc func(ctx context.Context, t *meili.TaskInfo) error,
-	idx meili.IndexManager,
-	triggerType types.TriggerOpType,
-	document database.Result,
-	primaryValue string,
-) error {
+// groupTasks groups tasks by index, so index of many sources is prepared and
+// swapped once in bulk sync.
+func groupTasks(tasks []task) [][]task {
+	groups := make([][]task, 0, len(tasks))
+	byIndex := make(map[string]int)
 
-	switch triggerType {
-	case types.INSERT, types.UPDATE:
-		task, err := idx.UpdateDocumentsWithContext(ctx, document)
-		if err != nil {
-			return err
+	for _, t := range tasks {
+		i, ok := byIndex[t.des.IndexName]
+		if !ok {
+			i = len(groups)
+			byIndex[t.des.IndexName] = i
+			groups = append(groups, nil)
 		}
+		groups[i] = append(groups[i], t)
+	}
 
-		if err := waitFunc(ctx, task); err != nil {
-			return err
-		}
-	case types.DELETE:
-		task, err := idx.DeleteDocument(primaryValue)
-		if err != nil {
-			return err
+	return groups
+}
+
+// findTask returns task of index, source (collection of index map) is required
+// if many sources feed index.
+func findTask(tasks []task, uid, source string) (task, error) {
+	found := make([]task, 0, 1)
+	for _, t := range tasks {
+		if t.des.IndexName != uid {
+			continue
 		}
 
-		if err := waitFunc(ctx, task); err != nil {
-			return err
+		if source != "" && source != t.col.String() && source != t.col.GetCollection() {
+			continue
 		}
+
+		found = append(found, t)
 	}
-	return nil
+
+	switch len(found) {
+	case 0:
+		return task{}, fmt.Errorf("%w %s", errInvalidIndexUID, uid)
+	case 1:
+		return found[0], nil
+	}
+
+	return task{}, fmt.Errorf("%w %s", errAmbiguousIndex, uid)
+}
+
+func processTrigger(
+	b *indexBatcher,
+	triggerType types.TriggerOpType,
+	documents []*database.Result,
+	primaryValue string,
+) *batchWrite {
+	// trigger is done when its batch is finished, so failed trigger is retried by queue
+	switch triggerType {
+	case types.INSERT, types.UPDATE:
+		return b.Replace(documents)
+	case types.DELETE:
+		return b.Delete(primaryValue)
+	}
+	return doneWrite(nil)
 }
@@ -1,7 +1,11 @@
 package bridge
 
 import (
+	"context"
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -56,3 +60,85 @@ func Test_IsValidToken(t *testing.T) {
 		})
 	}
 }
+
+type swapMeili struct {
+	meilisearch.Meilisearch
+	indexes map[string]bool
+	calls   []string
+}
+
+func (s *swapMeili) IsExistsIndex(_ context.Context, uid string) bool {
+	return s.indexes[uid]
+}
+
+func (s *swapMeili) CreateIndex(_ context.Context, uid, _ string) error {
+	s.indexes[uid] = true
+	s.calls = append(s.calls, "create "+uid)
+	return nil
+}
+
+func (s *swapMeili) SwapIndexes(_ context.Context, first, second string) error {
+	s.calls = append(s.calls, "swap "+first+" "+second)
+	return nil
+}
+
+func (s *swapMeili) DeleteIndex(_ context.Context, uid string) error {
+	delete(s.indexes, uid)
+	s.calls = append(s.calls, "delete "+uid)
+	return nil
+}
+
+func Test_SwapIndex(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Indexes  map[string]bool
+		Excepted []string
+	}{
+		{
+			Name:     "live exists",
+			Indexes:  map[string]bool{"idx1": true, "idx1_tmp": true},
+			Excepted: []string{"swap idx1 idx1_tmp", "delete idx1_tmp"},
+		},
+		{
+			Name:     "first bulk",
+			Indexes:  map[string]bool{"idx1_tmp": true},
+			Excepted: []string{"create idx1", "swap idx1 idx1_tmp", "delete idx1_tmp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := &swapMeili{indexes: tt.Indexes}
+			require.NoError(t, swapIndex(context.Background(), m, "idx1", "idx1_tmp", "id"))
+			assert.Equal(t, tt.Excepted, m.calls)
+			assert.Equal(t, map[string]bool{"idx1": true}, m.indexes)
+		})
+	}
+}
+
+func Test_FindTask(t *testing.T) {
+	tasks := newTasks(map[config.Collection]config.Indexes{
+		"posts": {
+			{IndexName: "posts_en", PrimaryKey: "id"},
+			{IndexName: "posts_fr", PrimaryKey: "id"},
+		},
+		"users:users_view": {{IndexName: "search", PrimaryKey: "id"}},
+		"companies":        {{IndexName: "search", PrimaryKey: "id"}},
+	})
+
+	assert.Len(t, groupTasks(tasks), 3)
+
+	tsk, err := findTask(tasks, "posts_fr", "")
+	require.NoError(t, err)
+	assert.Equal(t, config.Collection("posts"), tsk.col)
+
+	_, err = findTask(tasks, "search", "")
+	assert.ErrorIs(t, err, errAmbiguousIndex)
+
+	tsk, err = findTask(tasks, "search", "users")
+	require.NoError(t, err)
+	assert.Equal(t, config.Collection("users:users_view"), tsk.col)
+
+	_, err = findTask(tasks, "unknown", "")
+	assert.ErrorIs(t, err, errInvalidIndexUID)
+}
@@ -0,0 +1,154 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/types"
+)
+
+// _maxDocumentIDLength is limit of meilisearch document id in bytes.
+const _maxDocumentIDLength = 511
+
+var (
+	errKeyNotFound = errors.New("key column not found")
+	errTriggerKey  = errors.New("trigger document doesn't have key of index")
+	errKeyTooLong  = errors.New("key is longer than 511 bytes, use hashed encoding")
+)
+
+// encodeKey builds primary key of index from key columns of doc, error is
+// returned if any column is missing or null. Joined key which isn't valid id,
+// is ambiguous or too long is hashed, so different keys never share an id.
+func encodeKey(k *config.Key, doc map[string]any) (string, error) {
+	values := make([]string, 0, len(k.Columns))
+	for _, col := range k.Columns {
+		v, ok := doc[col]
+		if !ok || v == nil {
+			return "", fmt.Errorf("%w: %s", errKeyNotFound, col)
+		}
+		// numbers of trigger JSON are float64, they are formatted like integers of source
+		switch n := v.(type) {
+		case float64, float32:
+			values = append(values, keyString(n))
+		default:
+			values = append(values, toString(n))
+		}
+	}
+
+	switch k.Encoding {
+	case config.HASHED:
+		return hashKey(values), nil
+	case config.BASE64URL:
+		id := base64.RawURLEncoding.EncodeToString([]byte(strings.Join(values, "\x00")))
+		if len(id) > _maxDocumentIDLength {
+			return "", errKeyTooLong
+		}
+		return id, nil
+	}
+
+	if !joinable(values, k.Separator) {
+		return hashKey(values), nil
+	}
+
+	id := strings.Join(values, k.Separator)
+	if len(id) > _maxDocumentIDLength {
+		return hashKey(values), nil
+	}
+
+	return id, nil
+}
+
+func hashKey(values []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// joinable reports whether joined values are valid id which can be split back
+// to values, so values must have only id characters and no separator.
+func joinable(values []string, sep string) bool {
+	if len(values) > 1 && sep == "" {
+		return false
+	}
+
+	for _, v := range values {
+		if v == "" || (sep != "" && strings.Contains(v, sep)) {
+			return false
+		}
+
+		for _, r := range v {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sourceKeys returns columns which locate document in source.
+func sourceKeys(des *config.IndexConfig) []string {
+	if des.Key != nil {
+		return des.Key.Columns
+	}
+	return []string{sourcePrimaryKey(des)}
+}
+
+// keyQuery returns values of source keys of row, ok is false if any of them is
+// missing or null.
+func keyQuery(des *config.IndexConfig, row database.Result) (map[string]any, bool) {
+	query := make(map[string]any, len(sourceKeys(des)))
+	for _, col := range sourceKeys(des) {
+		v, ok := row[col]
+		if !ok || v == nil {
+			return nil, false
+		}
+		query[col] = v
+	}
+	return query, true
+}
+
+// documentID returns id of document in index from values of source keys.
+func documentID(des *config.IndexConfig, query map[string]any) (string, error) {
+	if des.Key != nil {
+		return encodeKey(des.Key, query)
+	}
+	return fmt.Sprintf("%v", query[sourcePrimaryKey(des)]), nil
+}
+
+// triggerQuery returns values of source keys of trigger item, items of index
+// with key columns locate document by keys. Names of query are taken from index
+// config only, names sent by trigger aren't trusted as they're used in query.
+func triggerQuery(des *config.IndexConfig, item types.TriggerRequestBody) (map[string]any, error) {
+	if des.Key == nil {
+		pk := sourcePrimaryKey(des)
+		if item.Document.PrimaryKey != pk && item.Document.PrimaryKey != des.PrimaryKey {
+			return nil, fmt.Errorf("%w: %s", errTriggerKey, pk)
+		}
+		return map[string]any{pk: item.Document.PrimaryValue}, nil
+	}
+
+	query := make(map[string]any, len(des.Key.Columns))
+	for _, col := range des.Key.Columns {
+		v, ok := item.Document.Keys[col]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errTriggerKey, col)
+		}
+		query[col] = v
+	}
+
+	return query, nil
+}
+
+// triggerID returns id of document of trigger item in index.
+func triggerID(des *config.IndexConfig, item types.TriggerRequestBody) (string, error) {
+	if des.Key != nil {
+		return encodeKey(des.Key, item.Document.Keys)
+	}
+	return fmt.Sprintf("%v", item.Document.PrimaryValue), nil
+}
@@ -0,0 +1,176 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EncodeKey(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Key      *config.Key
+		Document map[string]any
+		Excepted string
+		Err      error
+	}{
+		{
+			Name:     "joined",
+			Key:      &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.JOINED, Separator: "_"},
+			Document: map[string]any{"tenant_id": int64(7), "sku": "ab-12"},
+			Excepted: "7_ab-12",
+		},
+		{
+			Name:     "joined invalid characters are hashed",
+			Key:      &config.Key{Columns: []string{"path"}, Encoding: config.JOINED, Separator: "_"},
+			Document: map[string]any{"path": "docs/v1.2"},
+			Excepted: hashKey([]string{"docs/v1.2"}),
+		},
+		{
+			Name:     "joined value with separator is hashed",
+			Key:      &config.Key{Columns: []string{"a", "b"}, Encoding: config.JOINED, Separator: "_"},
+			Document: map[string]any{"a": "a_b", "b": "c"},
+			Excepted: hashKey([]string{"a_b", "c"}),
+		},
+		{
+			Name:     "joined too long is hashed",
+			Key:      &config.Key{Columns: []string{"a"}, Encoding: config.JOINED, Separator: "_"},
+			Document: map[string]any{"a": strings.Repeat("x", 512)},
+			Excepted: hashKey([]string{strings.Repeat("x", 512)}),
+		},
+		{
+			Name:     "base64url too long",
+			Key:      &config.Key{Columns: []string{"a"}, Encoding: config.BASE64URL},
+			Document: map[string]any{"a": strings.Repeat("x", 400)},
+			Err:      errKeyTooLong,
+		},
+		{
+			Name:     "joined json number",
+			Key:      &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.JOINED, Separator: "-"},
+			Document: map[string]any{"tenant_id": float64(1000000), "sku": "x"},
+			Excepted: "1000000-x",
+		},
+		{
+			Name:     "hashed",
+			Key:      &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.HASHED},
+			Document: map[string]any{"tenant_id": "7", "sku": "ab"},
+			Excepted: "927bf6143f11debc07a7c56eef3a1987533cfbebe12b320423e1a0e0804b0048",
+		},
+		{
+			Name:     "base64url",
+			Key:      &config.Key{Columns: []string{"tenant_id", "path"}, Encoding: config.BASE64URL},
+			Document: map[string]any{"tenant_id": "7", "path": "a/b.c"},
+			Excepted: "NwBhL2IuYw",
+		},
+		{
+			Name:     "missing column",
+			Key:      &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.JOINED, Separator: "_"},
+			Document: map[string]any{"tenant_id": "7", "sku": nil},
+			Err:      errKeyNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			id, err := encodeKey(tt.Key, tt.Document)
+			if tt.Err != nil {
+				assert.ErrorIs(t, err, tt.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, id)
+		})
+	}
+}
+
+func Test_MapDocumentsKey(t *testing.T) {
+	des := &config.IndexConfig{
+		IndexName:  "products",
+		PrimaryKey: "id",
+		Key:        &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.JOINED, Separator: "_"},
+		Fields:     map[string]string{"sku": "", "title": "name"},
+	}
+
+	doc := database.Result{"tenant_id": int64(7), "sku": "ab", "title": "Pen"}
+	docs, err := mapDocuments(context.Background(), []*database.Result{&doc}, des)
+	require.NoError(t, err)
+	assert.Equal(t, []*database.Result{{"id": "7_ab", "sku": "ab", "name": "Pen"}}, docs)
+}
+
+func Test_TriggerQuery(t *testing.T) {
+	keyed := &config.IndexConfig{
+		IndexName:  "products",
+		PrimaryKey: "id",
+		Key:        &config.Key{Columns: []string{"tenant_id", "sku"}, Encoding: config.JOINED, Separator: "_"},
+	}
+	renamed := &config.IndexConfig{
+		IndexName:  "users",
+		PrimaryKey: "id",
+		Fields:     map[string]string{"user_id": "id"},
+	}
+
+	tests := []struct {
+		Name     string
+		Index    *config.IndexConfig
+		Document types.Document
+		Excepted map[string]any
+		Err      error
+	}{
+		{
+			Name:     "keys",
+			Index:    keyed,
+			Document: types.Document{Keys: map[string]any{"tenant_id": 7, "sku": "a"}},
+			Excepted: map[string]any{"tenant_id": 7, "sku": "a"},
+		},
+		{
+			Name:  "extra key is dropped",
+			Index: keyed,
+			Document: types.Document{Keys: map[string]any{
+				"tenant_id": 7, "sku": "a", "1 = 1 OR sku": "a",
+			}},
+			Excepted: map[string]any{"tenant_id": 7, "sku": "a"},
+		},
+		{
+			Name:     "missing key",
+			Index:    keyed,
+			Document: types.Document{Keys: map[string]any{"tenant_id": 7}},
+			Err:      errTriggerKey,
+		},
+		{
+			Name:     "source primary key",
+			Index:    renamed,
+			Document: types.Document{PrimaryKey: "user_id", PrimaryValue: 1},
+			Excepted: map[string]any{"user_id": 1},
+		},
+		{
+			Name:     "index primary key",
+			Index:    renamed,
+			Document: types.Document{PrimaryKey: "id", PrimaryValue: 1},
+			Excepted: map[string]any{"user_id": 1},
+		},
+		{
+			Name:     "unknown primary key",
+			Index:    renamed,
+			Document: types.Document{PrimaryKey: "1 = 1 OR user_id", PrimaryValue: 1},
+			Err:      errTriggerKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			query, err := triggerQuery(tt.Index, types.TriggerRequestBody{Document: &tt.Document})
+			if tt.Err != nil {
+				assert.ErrorIs(t, err, tt.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, query)
+		})
+	}
+}
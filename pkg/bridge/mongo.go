@@ -2,10 +2,12 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Ja7ad/meilibridge/pkg/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"strings"
 	"sync"
 
 	meili "github.com/meilisearch/meilisearch-go"
@@ -15,16 +17,22 @@ import (
 	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
 	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
 )
 
 type mongo struct {
 	name         string
 	triggerToken string
 	executor     database.MongoExecutor
-	indexMap     map[config.Collection]*config.IndexConfig
+	tasks        []task
 	meili        meilisearch.Meilisearch
 	queue        *Queue
+	checkpoint   *checkpoint
 	log          logger.Logger
+	batchers     batchers
+
+	// startAt is operation time of snapshot by checkpoint key of task
+	startAt map[string]primitive.Timestamp
 }
 
 func (m *mongo) Name() string {
@@ -35,35 +43,112 @@ func (m *mongo) Trigger() http.HandlerFunc {
 	return triggerHandler(m.triggerToken, m.queue)
 }
 
-func (m *mongo) OnDemand(ctx context.Context) {
+func (m *mongo) BatchTrigger() http.HandlerFunc {
+	return batchTriggerHandler(m.triggerToken, m.queue, m.validateTrigger)
+}
+
+// validateTrigger returns error of item which can't be processed, so it isn't queued.
+func (m *mongo) validateTrigger(item types.TriggerRequestBody) error {
+	if err := item.Validate(); err != nil {
+		return err
+	}
+
+	t, err := findTask(m.tasks, item.IndexUID, item.Source)
+	if err != nil {
+		return err
+	}
+
+	_, err = triggerQuery(t.des, item)
+	return err
+}
+
+// findSource reads documents of changed document from source with filter and
+// pipeline of index, result is empty if document doesn't match filter.
+func (m *mongo) findSource(ctx context.Context, t task, id any, source string) ([]*database.Result, error) {
+	match := database.MatchFilter(bson.D{{Key: "_id", Value: id}}, mongoFilter(t.des))
+
+	// pipeline is re-run only for changed document
+	if pipeline := mongoPipeline(t.des); pipeline != nil {
+		return m.executor.Aggregate(ctx, source, match, pipeline)
+	}
+
+	doc, err := m.executor.FindOne(ctx, match, source)
+	if err != nil {
+		if t.des.Filter != nil && errors.Is(err, driver.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return []*database.Result{&doc}, nil
+}
+
+// expandIDs adds decoded _ids of every object id or uuid string value, raw value
+// is kept because string _id may look like object id or uuid.
+func expandIDs(values []any) []any {
+	expanded := make([]any, 0, len(values))
+	for _, v := range values {
+		expanded = append(expanded, v)
+		if s, ok := v.(string); ok {
+			expanded = append(expanded, decodeIDs(s)...)
+		}
+	}
+	return expanded
+}
+
+func (m *mongo) OnDemand(ctx context.Context, opts SyncOptions) {
 	var wg sync.WaitGroup
-	taskCh := make(chan task, len(m.indexMap))
+	taskCh := make(chan task, len(m.tasks))
+
+	if opts.Snapshot {
+		if err := m.snapshot(ctx); err != nil {
+			m.log.Error(err.Error())
+			return
+		}
+	}
 
-	for i := 0; i < len(m.indexMap); i++ {
+	if m.checkpoint != nil {
 		wg.Add(1)
-		go m.onDemandWorker(ctx, &wg, taskCh)
+		go func() {
+			defer wg.Done()
+			m.checkpoint.Run(ctx)
+		}()
 	}
 
-	for col, des := range m.indexMap {
-		taskCh <- task{col: col, des: des}
+	if opts.Workers < 1 {
+		opts.Workers = _defaultWorkers
+	}
+
+	for i := 0; i < len(m.tasks); i++ {
+		wg.Add(1)
+		go m.onDemandWorker(ctx, &wg, taskCh, opts)
+	}
+
+	for _, t := range m.tasks {
+		taskCh <- t
 	}
 	close(taskCh)
 
 	wg.Wait()
+	m.batchers.Close()
+
+	// tokens of events which are written on close are saved too
+	m.checkpoint.flush()
 }
 
-func (m *mongo) Bulk(ctx context.Context, isContinue bool) {
+func (m *mongo) Bulk(ctx context.Context, opts BulkOptions) {
 	var wg sync.WaitGroup
-	taskCh := make(chan task, len(m.indexMap))
-	statCh := make(chan stat, len(m.indexMap))
+	groups := groupTasks(m.tasks)
+	taskCh := make(chan []task, len(groups))
+	statCh := make(chan stat, len(m.tasks))
 
-	for i := 0; i < len(m.indexMap); i++ {
+	for i := 0; i < len(groups); i++ {
 		wg.Add(1)
-		go m.bulkWorker(ctx, &wg, taskCh, statCh, isContinue)
+		go m.bulkWorker(ctx, &wg, taskCh, statCh, opts)
 	}
 
-	for col, des := range m.indexMap {
-		taskCh <- task{col: col, des: des}
+	for _, g := range groups {
+		taskCh <- g
 	}
 	close(taskCh)
 
@@ -94,7 +179,7 @@ func (m *mongo) Bulk(ctx context.Context, isContinue bool) {
 	close(statCh)
 }
 
-func (m *mongo) onDemandWorker(ctx context.Context, wg *sync.WaitGroup, taskCh <-chan task) {
+func (m *mongo) onDemandWorker(ctx context.Context, wg *sync.WaitGroup, taskCh <-chan task, opts SyncOptions) {
 	defer wg.Done()
 
 	for {
@@ -106,14 +191,14 @@ func (m *mongo) onDemandWorker(ctx context.Context, wg *sync.WaitGroup, taskCh <
 				return
 			}
 
-			if err := m.handleTask(ctx, t); err != nil {
+			if err := m.handleTask(ctx, t, opts); err != nil {
 				m.log.Error(err.Error())
 			}
 		}
 	}
 }
 
-func (m *mongo) handleTask(ctx context.Context, t task) error {
+func (m *mongo) handleTask(ctx context.Context, t task, opts SyncOptions) error {
 	hasView, col, view := m.prepareCollections(t)
 
 	if !m.meili.IsExistsIndex(ctx, t.des.IndexName) {
@@ -122,26 +207,180 @@ func (m *mongo) handleTask(ctx context.Context, t task) error {
 		}
 	}
 
-	watch, err := m.executor.Watcher(ctx, col)
+	key := checkpointKey(t)
+
+	// filter of view is checked on view when event is handled
+	filter := mongoFilter(t.des)
+	if hasView {
+		filter = nil
+	}
+
+	watch, err := m.executor.Watcher(ctx, col, m.streamStart(t, key), filter)
+	if errors.Is(err, database.ErrResumeTokenLost) {
+		m.log.Warn("change stream can't resume, syncing index with continue bulk",
+			"collection", t.col, "index", t.des.IndexName, "err", err)
+
+		// start watching before bulk, so changes during bulk are applied after it
+		watch, err = m.executor.Watcher(ctx, col, database.StreamStart{}, filter)
+		if err != nil {
+			return err
+		}
+
+		if err := m.bulkIndex(ctx, []task{t}, BulkOptions{Continue: true}, nil); err != nil {
+			return err
+		}
+	}
 	if err != nil {
 		return err
 	}
 
 	idx := m.meili.Index(t.des.IndexName)
 
+	source := view
+	if !hasView {
+		source = col
+	}
+
+	for _, dep := range t.des.Dependencies {
+		go m.watchDependency(ctx, idx, t, dep, source)
+	}
+
+	// resume token is saved after its event and all events before it are written,
+	// so failed or pending event is read again after restart
+	progress := database.NewProgress(func(token []byte) {
+		m.checkpoint.Save(key, token)
+	})
+
+	workers := newOrderedWorkers(ctx, opts.Workers, opts.Coalesce, func(ctx context.Context, events []changeEvent) {
+		m.applyEvents(ctx, idx, t, events, hasView, view).Notify(func(err error) {
+			if err != nil {
+				m.log.Error(err.Error(), "collection", t.col, "index", t.des.IndexName)
+			}
+
+			for _, ev := range events {
+				ev.ack(err)
+			}
+		})
+	})
+	defer workers.Close()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-progress.Failed():
+			// resume token can't pass failed event, stream resumes from it after restart
+			return fmt.Errorf("change stream of %s stopped, index %s isn't synced: %w",
+				t.col, t.des.IndexName, progress.Err())
 		case w, ok := <-watch:
 			if !ok {
 				return nil
 			}
-			if err := m.handleWatchEvent(ctx, idx, t, w, hasView, view); err != nil {
-				m.log.Error(err.Error())
+
+			wType, res := w()
+			workers.Push(ctx, keyString(res.DocumentId), changeEvent{
+				wType: wType,
+				res:   res,
+				ack:   progress.Add(res.ResumeToken, 1),
+			})
+		}
+	}
+}
+
+// snapshot loads indexes which have no resume token with bulk sync, operation
+// time is taken before bulk and change streams of their tasks start at it, so
+// changes during bulk are applied after it in order. Index is filled in temporary
+// index and swapped, so live index isn't dropped, and finished snapshot is kept
+// with its operation time, so it isn't loaded again after restart.
+func (m *mongo) snapshot(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	m.startAt = make(map[string]primitive.Timestamp)
+
+	for _, tasks := range groupTasks(m.tasks) {
+		fresh := true
+		for _, t := range tasks {
+			if m.checkpoint.Load(checkpointKey(t)) != nil {
+				fresh = false
+			}
+		}
+
+		if !fresh {
+			continue
+		}
+
+		if ts, ok := m.snapshotTime(tasks); ok {
+			for _, t := range tasks {
+				m.startAt[checkpointKey(t)] = ts
+			}
+			continue
+		}
+
+		ts, err := m.executor.OperationTime(ctx)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			m.log.InfoContext(ctx, "loading snapshot of index", "index", tasks[0].des.IndexName)
+
+			err := m.bulkIndex(ctx, tasks, BulkOptions{Swap: true}, nil)
+			if err == nil {
+				for _, t := range tasks {
+					if err = m.checkpoint.SaveSnapshot(checkpointKey(t), ts); err != nil {
+						break
+					}
+				}
 			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to load snapshot of index %s: %w", tasks[0].des.IndexName, err))
+				return
+			}
+
+			for _, t := range tasks {
+				m.startAt[checkpointKey(t)] = ts
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// snapshotTime returns operation time of finished snapshot of tasks, ok is false
+// if any of tasks isn't loaded.
+func (m *mongo) snapshotTime(tasks []task) (primitive.Timestamp, bool) {
+	var ts primitive.Timestamp
+	for _, t := range tasks {
+		at, ok := m.checkpoint.LoadSnapshot(checkpointKey(t))
+		if !ok {
+			return primitive.Timestamp{}, false
 		}
+		ts = at
+	}
+	return ts, true
+}
+
+// streamStart returns start of change stream with checkpoint key, operation
+// time of snapshot is used if there is no resume token.
+func (m *mongo) streamStart(t task, key string) database.StreamStart {
+	start := database.StreamStart{ResumeToken: m.checkpoint.Load(key)}
+	if ts, ok := m.startAt[checkpointKey(t)]; ok {
+		start.OperationTime = &ts
 	}
+	return start
 }
 
 func (m *mongo) prepareCollections(t task) (bool, string, string) {
@@ -158,28 +397,71 @@ func (m *mongo) prepareCollections(t task) (bool, string, string) {
 	return hasView, col, view
 }
 
-func (m *mongo) handleWatchEvent(
+// applyEvents applies events of one document in order, many coalesced events are
+// written once as latest document of source, or deleted if last one is delete.
+// Returned write is done when events are written to index.
+func (m *mongo) applyEvents(
 	ctx context.Context,
 	idx meili.IndexManager,
 	t task,
-	w func() (database.WatcherType, database.WatchResult),
+	events []changeEvent,
 	hasView bool,
 	view string,
-) error {
-	wType, res := w()
+) *batchWrite {
+	source := view
+	if !hasView {
+		source = t.col.String()
+	}
+
+	last := events[len(events)-1]
 
-	switch wType {
+	if len(events) > 1 {
+		if last.wType == database.OnDelete {
+			return m.handleDelete(ctx, idx, t, last.res)
+		}
+
+		return m.handleRefresh(ctx, idx, t, last.res, source)
+	}
+
+	switch last.wType {
 	case database.OnInsert:
-		go m.handleInsert(ctx, idx, t, res, hasView, view)
+		return m.handleInsert(ctx, idx, t, last.res, hasView, view)
 	case database.OnUpdate:
-		go m.handleUpdate(ctx, idx, t, res, view)
+		return m.handleUpdate(ctx, idx, t, last.res, source)
 	case database.OnReplace:
-		go m.handleReplace(ctx, idx, t, res, hasView, view)
+		return m.handleReplace(ctx, idx, t, last.res, hasView, view)
 	case database.OnDelete:
-		go m.handleDelete(ctx, idx, t, res)
+		return m.handleDelete(ctx, idx, t, last.res)
 	default:
+		return doneWrite(nil)
 	}
-	return nil
+}
+
+// handleRefresh writes latest document of source to index, document which no
+// longer exists or matches filter is removed.
+func (m *mongo) handleRefresh(
+	ctx context.Context,
+	idx meili.IndexManager,
+	t task,
+	res database.WatchResult,
+	source string,
+) *batchWrite {
+	m.log.InfoContext(ctx, fmt.Sprintf("refresh document %s", keyString(res.DocumentId)),
+		"collection", t.col, "index", t.des.IndexName)
+
+	results, err := m.findSource(ctx, t, res.DocumentId, source)
+	if errors.Is(err, driver.ErrNoDocuments) {
+		results, err = nil, nil
+	}
+	if err != nil {
+		return doneWrite(fmt.Errorf("failed find documents in source of index %s: %w", t.des.IndexName, err))
+	}
+
+	if len(results) == 0 {
+		return m.handleDelete(ctx, idx, t, res)
+	}
+
+	return m.upsert(ctx, idx, t, results)
 }
 
 func (m *mongo) handleInsert(
@@ -189,32 +471,29 @@ func (m *mongo) handleInsert(
 	res database.WatchResult,
 	hasView bool,
 	view string,
-) {
-	m.log.InfoContext(ctx, fmt.Sprintf("add new document %s", res.DocumentId.Hex()),
+) *batchWrite {
+	m.log.InfoContext(ctx, fmt.Sprintf("add new document %s", keyString(res.DocumentId)),
 		"collection", t.col, "index", t.des.IndexName)
 
-	result := res.Document
-	if hasView {
+	results := []*database.Result{&res.Document}
+	if hasView || t.des.Pipeline != nil {
+		source := view
+		if !hasView {
+			source = t.col.String()
+		}
+
 		var err error
-		result, err = m.executor.FindOne(ctx, bson.D{{"_id", res.DocumentId}}, view)
+		results, err = m.findSource(ctx, t, res.DocumentId, source)
 		if err != nil {
-			m.log.Warn(fmt.Sprintf("failed find documents in view index: %s", t.des.IndexName),
-				"err", err.Error())
-			return
+			return doneWrite(fmt.Errorf("failed find documents in view index %s: %w", t.des.IndexName, err))
 		}
-	}
 
-	updateItemKeys([]*database.Result{&result}, t.des.Fields)
-	tInfo, err := idx.AddDocuments(&result)
-	if err != nil {
-		m.log.Error(fmt.Sprintf("failed to add documents to index: %s", t.des.IndexName),
-			"err", err.Error())
-		return
+		if len(results) == 0 {
+			return doneWrite(nil)
+		}
 	}
 
-	if err := m.meili.WaitForTask(ctx, tInfo); err != nil {
-		m.log.Error("failed to wait for complete insert task", "err", err.Error())
-	}
+	return m.upsert(ctx, idx, t, results)
 }
 
 func (m *mongo) handleUpdate(
@@ -222,35 +501,49 @@ func (m *mongo) handleUpdate(
 	idx meili.IndexManager,
 	t task,
 	res database.WatchResult,
-	view string,
-) {
-	m.log.InfoContext(ctx, fmt.Sprintf("updating document %s", res.DocumentId.Hex()),
+	source string,
+) *batchWrite {
+	id := keyString(res.DocumentId)
+
+	m.log.InfoContext(ctx, fmt.Sprintf("updating document %s", id),
 		"collection", t.col, "index", t.des.IndexName)
 
-	doc := make(database.Result)
-	err := idx.GetDocument(res.DocumentId.Hex(), nil, &doc)
-	if err != nil {
-		doc, err = m.executor.FindOne(ctx, bson.D{{"_id", res.DocumentId}}, view)
+	// updated fields which can't be merged into document of index are read from source
+	if !mergeableUpdate(t.des, res) {
+		results, err := m.findSource(ctx, t, res.DocumentId, source)
 		if err != nil {
-			m.log.Warn(fmt.Sprintf("failed find documents in view index: %s", t.des.IndexName),
-				"err", err.Error())
-			return
+			return doneWrite(fmt.Errorf("failed find documents in view index %s: %w", t.des.IndexName, err))
 		}
-		updateItemKeys([]*database.Result{&doc}, t.des.Fields)
-		tInfo, err := idx.AddDocuments(&doc)
-		if err != nil {
-			m.log.Error(fmt.Sprintf("failed to add documents to index: %s", t.des.IndexName),
-				"err", err.Error())
-			return
+
+		if len(results) == 0 {
+			return m.handleDelete(ctx, idx, t, res)
+		}
+
+		return m.upsert(ctx, idx, t, results)
+	}
+
+	// document of write which isn't finished yet is newer than document of index
+	b := m.batcher(ctx, idx, t)
+	doc, ok := b.Pending(id)
+	if !ok {
+		doc = make(database.Result)
+		if err := idx.GetDocument(id, nil, &doc); err != nil {
+			doc = nil
 		}
+	}
 
-		if err := m.meili.WaitForTask(ctx, tInfo); err != nil {
-			m.log.Error("failed to wait for complete insert task", "err", err.Error())
+	if doc == nil {
+		src, err := m.executor.FindOne(ctx, bson.D{{Key: "_id", Value: res.DocumentId}}, source)
+		if err != nil {
+			return doneWrite(fmt.Errorf("failed find documents in view index %s: %w", t.des.IndexName, err))
 		}
+
+		// document of source already has updated fields
+		return m.upsert(ctx, idx, t, []*database.Result{&src})
 	}
 
 	for k, v := range res.Update.UpdateFields {
-		if _, ok := doc[k]; ok {
+		if _, ok := t.des.Fields[k]; ok || t.des.Fields == nil {
 			doc[k] = v
 		}
 	}
@@ -260,17 +553,40 @@ func (m *mongo) handleUpdate(
 			delete(doc, field)
 		}
 	}
+	transformDocuments([]*database.Result{&doc}, t.des.Transforms)
 
-	tInfo, err := idx.UpdateDocuments(&doc, t.des.PrimaryKey)
-	if err != nil {
-		m.log.Error(fmt.Sprintf("failed to update document to index: %s", t.des.IndexName),
-			"err", err.Error())
-		return
+	return b.Upsert([]*database.Result{&doc})
+}
+
+// mergeableUpdate reports whether updated fields of event can be merged into
+// document of index as they are. Output of script, pipeline, flatten and built
+// key can't be merged, updated document must be checked with filter, and fields
+// which are paths or renamed and nested updates don't have keys of index document.
+func mergeableUpdate(des *config.IndexConfig, res database.WatchResult) bool {
+	if des.Script != nil || des.Filter != nil || des.Pipeline != nil || des.Flatten != nil || des.Key != nil {
+		return false
+	}
+
+	for k, v := range des.Fields {
+		// _id isn't updated, so its name doesn't matter
+		if isFieldPath(k) || (k != "_id" && v != "" && v != k) {
+			return false
+		}
 	}
 
-	if err := m.meili.WaitForTask(ctx, tInfo); err != nil {
-		m.log.Error("failed to wait for complete update task", "err", err.Error())
+	for k := range res.Update.UpdateFields {
+		if strings.Contains(k, ".") {
+			return false
+		}
 	}
+
+	for _, k := range res.Update.RemoveFields {
+		if strings.Contains(k, ".") {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (m *mongo) handleReplace(
@@ -280,177 +596,325 @@ func (m *mongo) handleReplace(
 	res database.WatchResult,
 	hasView bool,
 	view string,
-) {
-	m.log.InfoContext(ctx, fmt.Sprintf("replace document %s", res.DocumentId.Hex()),
+) *batchWrite {
+	m.log.InfoContext(ctx, fmt.Sprintf("replace document %s", keyString(res.DocumentId)),
 		"collection", t.col, "index", t.des.IndexName)
 
-	if hasView {
+	results := []*database.Result{&res.Document}
+	if hasView || t.des.Filter != nil || t.des.Pipeline != nil {
+		source := view
+		if !hasView {
+			source = t.col.String()
+		}
+
 		var err error
-		res.Document, err = m.executor.FindOne(ctx, bson.M{"_id": res.DocumentId}, view)
+		results, err = m.findSource(ctx, t, res.DocumentId, source)
 		if err != nil {
-			m.log.Warn(fmt.Sprintf("failed find documents in view index: %s", t.des.IndexName),
-				"err", err.Error())
-			return
+			return doneWrite(fmt.Errorf("failed find documents in view index %s: %w", t.des.IndexName, err))
 		}
-	}
 
-	tInfo, err := idx.UpdateDocuments(&res.Document, t.des.PrimaryKey)
-	if err != nil {
-		m.log.Error(fmt.Sprintf("failed to replace document to index: %s", t.des.IndexName),
-			"err", err.Error())
-		return
-	}
-	if err := m.meili.WaitForTask(ctx, tInfo); err != nil {
-		m.log.Error("failed to wait for complete replace task", "err", err.Error())
+		if len(results) == 0 {
+			return m.handleDelete(ctx, idx, t, res)
+		}
 	}
+
+	return m.upsert(ctx, idx, t, results)
 }
 
-func (m *mongo) handleDelete(ctx context.Context, idx meili.IndexManager, t task, res database.WatchResult) {
-	m.log.InfoContext(ctx, fmt.Sprintf("remove document %s", res.DocumentId.Hex()),
+func (m *mongo) handleDelete(ctx context.Context, idx meili.IndexManager, t task, res database.WatchResult) *batchWrite {
+	m.log.InfoContext(ctx, fmt.Sprintf("remove document %s", keyString(res.DocumentId)),
 		"collection", t.col, "index", t.des.IndexName)
-	id := res.DocumentId.Hex()
-	tInfo, err := idx.DeleteDocument(id)
+
+	return m.batcher(ctx, idx, t).Delete(keyString(res.DocumentId))
+}
+
+// upsert maps documents of source and adds them to batch of index, documents of
+// index are replaced, so fields removed in source are removed from index.
+func (m *mongo) upsert(ctx context.Context, idx meili.IndexManager, t task, results []*database.Result) *batchWrite {
+	docs, err := mapDocuments(ctx, results, t.des)
 	if err != nil {
-		m.log.Error(fmt.Sprintf("failed to remove document to index: %s", t.des.IndexName),
-			"err", err.Error())
-		return
+		return doneWrite(fmt.Errorf("failed to map document of index %s: %w", t.des.IndexName, err))
 	}
 
-	if err := m.meili.WaitForTask(ctx, tInfo); err != nil {
-		m.log.Error("failed to wait for complete delete task", "err", err.Error())
-	}
+	return m.batcher(ctx, idx, t).Replace(docs)
+}
+
+// batcher returns batcher of index of task.
+func (m *mongo) batcher(ctx context.Context, idx meili.IndexManager, t task) *indexBatcher {
+	return m.batchers.get(ctx, idx, t.des, m.meili.WaitForTask, m.log)
 }
 
 func (m *mongo) bulkWorker(ctx context.Context,
 	wg *sync.WaitGroup,
-	taskCh <-chan task,
+	taskCh <-chan []task,
 	statCh chan<- stat,
-	isContinue bool,
+	opts BulkOptions,
 ) {
 	defer wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case t, ok := <-taskCh:
+		case tasks, ok := <-taskCh:
 			if !ok {
 				return
 			}
 
-			col := t.col.String()
-
-			if t.col.HasView() {
-				_, col = t.col.GetCollectionAndView()
-			}
-
-			m.executor.AddCollection(col)
-
-			count, err := m.executor.Count(ctx, col)
-			if err != nil {
+			if err := m.bulkIndex(ctx, tasks, opts, statCh); err != nil {
 				statCh <- stat{err: err}
 				return
 			}
+		}
+	}
+}
 
-			if !isContinue {
-				if err := recreateIndex(ctx,
-					t.des.IndexName,
-					t.des.PrimaryKey,
-					t.des.Settings,
-					m.meili); err != nil {
-					m.log.Fatal("failed to recreate index", "err", err)
-				}
-			} else {
-				if !m.meili.IsExistsIndex(ctx, t.des.IndexName) {
-					m.log.Fatal(fmt.Sprintf("index %s does not exist for resync", t.des.IndexName))
-				}
-			}
+// bulkIndex syncs all documents of collections of tasks to their shared index,
+// progress is reported to statCh if it's not nil.
+func (m *mongo) bulkIndex(ctx context.Context, tasks []task, opts BulkOptions, statCh chan<- stat) error {
+	des := tasks[0].des
 
-			idx := m.meili.Index(t.des.IndexName)
-			cur, err := m.executor.FindLimit(ctx, _bulkLimit, col)
-			if err != nil {
-				statCh <- stat{err: err}
-				return
+	target, err := prepareBulkIndex(ctx, m.meili, des, opts)
+	if err != nil {
+		return err
+	}
+
+	marks := make([]any, len(tasks))
+	for i, t := range tasks {
+		col := t.col.String()
+
+		if t.col.HasView() {
+			_, col = t.col.GetCollectionAndView()
+		}
+
+		m.executor.AddCollection(col)
+
+		marks[i], err = m.fillIndex(ctx, t, col, target, checkpointKey(t), opts.Continue, statCh)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && target != des.IndexName {
+		err = swapIndex(ctx, m.meili, des.IndexName, target, des.PrimaryKey)
+	}
+	if err != nil {
+		if target != des.IndexName {
+			dropIndex(ctx, m.meili, target, m.log)
+		}
+		return err
+	}
+
+	for i, t := range tasks {
+		if err := m.checkpoint.SaveWatermark(checkpointKey(t), marks[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fillIndex pushes documents of collection to target index and returns
+// high-water mark of incremental index.
+func (m *mongo) fillIndex(
+	ctx context.Context,
+	t task,
+	col, target, key string,
+	isContinue bool,
+	statCh chan<- stat,
+) (any, error) {
+	count, err := m.executor.Count(ctx, col, mongoFilter(t.des))
+	if err != nil {
+		return nil, err
+	}
+
+	since, mark, err := m.watermark(ctx, t, col, key, isContinue)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := m.meili.Index(target)
+
+	var cur database.Cursor
+	if pipeline := mongoPipeline(t.des); pipeline != nil {
+		cur, err = m.executor.AggregateLimit(ctx, _bulkLimit, col, since, mongoFilter(t.des), pipeline)
+	} else {
+		cur, err = m.executor.FindLimit(ctx, _bulkLimit, col, since, mongoFilter(t.des))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	totalIndexed := int64(0)
+
+	for cur.Next(ctx) {
+		items, err := cur.Result()
+		if err != nil {
+			return nil, err
+		}
+
+		items, err = mapDocumentsSkip(ctx, items, t.des, skipScriptError(m.log, t.des))
+		if err != nil {
+			return nil, err
+		}
+
+		tsk, err := idx.UpdateDocuments(&items)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := m.meili.WaitForTask(ctx, tsk); err != nil {
+			return nil, err
+		}
+
+		totalIndexed += int64(len(items))
+
+		if statCh != nil {
+			statCh <- stat{
+				col:     col,
+				index:   t.des.IndexName,
+				total:   count,
+				indexed: totalIndexed,
+				err:     nil,
 			}
+		}
+	}
 
-			totalIndexed := int64(0)
+	if _, err := cur.Result(); err != nil {
+		return nil, err
+	}
 
-			for cur.Next(ctx) {
-				items, err := cur.Result()
-				if err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	return mark, nil
+}
 
-				updateItemKeys(items, t.des.Fields)
+// watermark returns cursor watermark from last successful run and high-water mark
+// of current run for incremental index.
+func (m *mongo) watermark(
+	ctx context.Context,
+	t task,
+	col, key string,
+	isContinue bool,
+) (*database.Watermark, any, error) {
+	if t.des.Incremental == nil {
+		return nil, nil, nil
+	}
 
-				tsk, err := idx.UpdateDocuments(&items)
-				if err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	// high-water mark is taken before sync, documents changed during sync are sent again on next run
+	mark, err := m.executor.Max(ctx, col, t.des.Incremental.Column)
+	if err != nil {
+		return nil, nil, err
+	}
 
-				if err := m.meili.WaitForTask(ctx, tsk); err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	if !isContinue {
+		return nil, mark, nil
+	}
 
-				totalIndexed += int64(len(items))
+	last, err := m.checkpoint.LoadWatermark(key)
+	if err != nil {
+		return nil, nil, err
+	}
 
-				statCh <- stat{
-					col:     col,
-					index:   t.des.IndexName,
-					total:   count,
-					indexed: totalIndexed,
-					err:     nil,
-				}
+	return &database.Watermark{Column: t.des.Incremental.Column, Value: last}, mark, nil
+}
+
+func (m *mongo) Reconcile(ctx context.Context, dryRun bool) error {
+	for _, tasks := range groupTasks(m.tasks) {
+		des := tasks[0].des
+
+		if !m.meili.IsExistsIndex(ctx, des.IndexName) {
+			continue
+		}
+
+		// document of index of many sources exists if any source has it
+		exists := make([]existsFunc, 0, len(tasks))
+		for _, t := range tasks {
+			col := t.col.String()
+
+			if t.col.HasView() {
+				_, col = t.col.GetCollectionAndView()
 			}
+
+			m.executor.AddCollection(col)
+			pk, filter := sourcePrimaryKey(t.des), mongoFilter(t.des)
+
+			exists = append(exists, func(ctx context.Context, keys []any) ([]any, error) {
+				// object ids are stored as hex string in index
+				return m.executor.Exists(ctx, col, pk, expandIDs(keys), filter)
+			})
 		}
+
+		report, err := reconcile(ctx, m.meili, des.IndexName, des.PrimaryKey, existsAny(exists), dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to reconcile index %s: %w", des.IndexName, err)
+		}
+
+		logReconcileReport(ctx, m.log, m.name, report, dryRun)
 	}
+
+	return nil
 }
 
-func (m *mongo) processTrigger(ctx context.Context, item types.TriggerRequestBody) (bool, error) {
-	col, idx := indexConfigByUID(item.IndexUID, m.indexMap)
-	if idx == nil {
-		return false, fmt.Errorf("invalid index UID %s", item.IndexUID)
+func (m *mongo) processTrigger(ctx context.Context, item types.TriggerRequestBody) (*batchWrite, bool) {
+	t, err := findTask(m.tasks, item.IndexUID, item.Source)
+	if err != nil {
+		return doneWrite(err), false
+	}
+	col, idx := t.col.GetView(), t.des
+
+	if _, err := triggerQuery(idx, item); err != nil {
+		return doneWrite(err), false
 	}
 
 	if !m.meili.IsExistsIndex(ctx, idx.IndexName) {
 		if err := recreateIndex(ctx, idx.IndexName, idx.PrimaryKey, idx.Settings, m.meili); err != nil {
-			return true, err
+			return doneWrite(err), true
 		}
 	}
 
-	var (
-		val        any
-		identifier string
-	)
-	val = item.Document.PrimaryValue
+	identifier := fmt.Sprintf("%v", item.Document.PrimaryValue)
+
+	// string value is matched as it is and as decoded object id or uuid
+	val := bson.M{"$in": expandIDs([]any{item.Document.PrimaryValue})}
+
+	typ := item.Type
+
+	res, ok := inlineDocument(item)
+	results := []*database.Result{&res}
+	if !ok && typ != types.DELETE {
+		match := database.MatchFilter(bson.M{item.Document.PrimaryKey: val}, mongoFilter(idx))
+
+		var err error
+		if pipeline := mongoPipeline(idx); pipeline != nil {
+			results, err = m.executor.Aggregate(ctx, col, match, pipeline)
+			if err != nil {
+				return doneWrite(err), true
+			}
 
-	identifier = fmt.Sprintf("%v", item.Document.PrimaryValue)
+			// document is removed or doesn't match filter of index anymore
+			if len(results) == 0 {
+				typ = types.DELETE
+			}
+		} else {
+			res, err = m.executor.FindOne(ctx, match, col)
+			if err != nil {
+				if idx.Filter == nil || !errors.Is(err, driver.ErrNoDocuments) {
+					return doneWrite(err), true
+				}
 
-	obj, ok := item.Document.PrimaryValue.(string)
-	if ok {
-		v, err := primitive.ObjectIDFromHex(obj)
-		if err == nil {
-			val = v
-			identifier = obj
+				// document doesn't match filter of index anymore
+				typ = types.DELETE
+			}
 		}
 	}
 
-	res, err := m.executor.FindOne(ctx, bson.M{item.Document.PrimaryKey: val}, col)
+	docs, err := mapDocuments(ctx, results, idx)
 	if err != nil {
-		return true, err
+		return doneWrite(err), true
 	}
 
-	if err := processTrigger(ctx,
-		m.meili.WaitForTask,
-		m.meili.Index(item.IndexUID),
-		item.Type,
-		res,
+	return processTrigger(
+		m.batchers.get(ctx, m.meili.Index(item.IndexUID), idx, m.meili.WaitForTask, m.log),
+		typ,
+		docs,
 		identifier,
-	); err != nil {
-		return true, err
-	}
-
-	return false, nil
+	), true
 }
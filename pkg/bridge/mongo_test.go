@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_MergeableUpdate(t *testing.T) {
+	update := func(fields database.Result, removed ...string) database.WatchResult {
+		var res database.WatchResult
+		res.Update.UpdateFields = fields
+		res.Update.RemoveFields = removed
+		return res
+	}
+
+	tests := []struct {
+		Name     string
+		Des      *config.IndexConfig
+		Result   database.WatchResult
+		Excepted bool
+	}{
+		{
+			Name:     "all fields",
+			Des:      &config.IndexConfig{},
+			Result:   update(database.Result{"name": "foo"}, "age"),
+			Excepted: true,
+		},
+		{
+			Name:     "renamed id",
+			Des:      &config.IndexConfig{Fields: map[string]string{"_id": "id", "name": ""}},
+			Result:   update(database.Result{"name": "foo"}),
+			Excepted: true,
+		},
+		{
+			Name:     "renamed field",
+			Des:      &config.IndexConfig{Fields: map[string]string{"name": "title"}},
+			Result:   update(database.Result{"name": "foo"}),
+			Excepted: false,
+		},
+		{
+			Name:     "path field",
+			Des:      &config.IndexConfig{Fields: map[string]string{"tags[].name": ""}},
+			Result:   update(database.Result{"tags": []any{}}),
+			Excepted: false,
+		},
+		{
+			Name:     "flatten",
+			Des:      &config.IndexConfig{Flatten: &config.Flatten{}},
+			Result:   update(database.Result{"name": "foo"}),
+			Excepted: false,
+		},
+		{
+			Name:     "nested update",
+			Des:      &config.IndexConfig{},
+			Result:   update(database.Result{"address.city": "foo"}),
+			Excepted: false,
+		},
+		{
+			Name:     "nested remove",
+			Des:      &config.IndexConfig{},
+			Result:   update(nil, "address.city"),
+			Excepted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, mergeableUpdate(tt.Des, tt.Result))
+		})
+	}
+}
+
+func Test_ExpandIDs(t *testing.T) {
+	oid := primitive.NewObjectID()
+	data := []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+
+	tests := []struct {
+		Name     string
+		Values   []any
+		Excepted []any
+	}{
+		{
+			Name:     "object id",
+			Values:   []any{oid.Hex()},
+			Excepted: []any{oid.Hex(), oid},
+		},
+		{
+			Name:   "uuid",
+			Values: []any{"123e4567-e89b-12d3-a456-426614174000"},
+			Excepted: []any{
+				"123e4567-e89b-12d3-a456-426614174000",
+				primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: data},
+				primitive.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: data},
+			},
+		},
+		{
+			Name:     "string and number",
+			Values:   []any{"user-1", 42},
+			Excepted: []any{"user-1", 42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, expandIDs(tt.Values))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package bridge
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/pkg/database"
+)
+
+const _orderedQueueSize = 128
+
+// changeEvent is change stream event of document, ack is called with result of
+// its write.
+type changeEvent struct {
+	wType database.WatcherType
+	res   database.WatchResult
+	ack   func(err error)
+}
+
+type keyedEvent struct {
+	key string
+	ev  changeEvent
+}
+
+// orderedWorkers applies change events by many workers, events of same document
+// are hashed to same worker, so they are applied in order of stream. Events of
+// document which arrive within window are coalesced and applied together.
+type orderedWorkers struct {
+	queues []chan keyedEvent
+	window time.Duration
+	apply  func(ctx context.Context, events []changeEvent)
+	wg     sync.WaitGroup
+}
+
+func newOrderedWorkers(
+	ctx context.Context,
+	workers int,
+	window time.Duration,
+	apply func(ctx context.Context, events []changeEvent),
+) *orderedWorkers {
+	if workers < 1 {
+		workers = 1
+	}
+
+	o := &orderedWorkers{
+		queues: make([]chan keyedEvent, workers),
+		window: window,
+		apply:  apply,
+	}
+
+	for i := range o.queues {
+		o.queues[i] = make(chan keyedEvent, _orderedQueueSize)
+
+		o.wg.Add(1)
+		go o.worker(ctx, o.queues[i])
+	}
+
+	return o
+}
+
+// Push sends event of document key to its worker, it blocks if worker is busy.
+func (o *orderedWorkers) Push(ctx context.Context, key string, ev changeEvent) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	select {
+	case <-ctx.Done():
+	case o.queues[h.Sum32()%uint32(len(o.queues))] <- keyedEvent{key: key, ev: ev}:
+	}
+}
+
+// Close applies pending events and waits for workers.
+func (o *orderedWorkers) Close() {
+	for _, q := range o.queues {
+		close(q)
+	}
+	o.wg.Wait()
+}
+
+func (o *orderedWorkers) worker(ctx context.Context, queue <-chan keyedEvent) {
+	defer o.wg.Done()
+
+	var (
+		pending = make(map[string][]changeEvent)
+		order   []string
+		flushC  <-chan time.Time
+	)
+
+	add := func(e keyedEvent) {
+		if _, ok := pending[e.key]; !ok {
+			order = append(order, e.key)
+		}
+		pending[e.key] = append(pending[e.key], e.ev)
+	}
+
+	flush := func(ctx context.Context) {
+		for _, key := range order {
+			o.apply(ctx, pending[key])
+		}
+
+		pending = make(map[string][]changeEvent)
+		order = order[:0]
+		flushC = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// queued and coalesced events are applied on shutdown, events which
+			// aren't pushed are read again from stream after restart
+		drain:
+			for {
+				select {
+				case e, ok := <-queue:
+					if !ok {
+						break drain
+					}
+					add(e)
+				default:
+					break drain
+				}
+			}
+
+			flush(context.WithoutCancel(ctx))
+			return
+		case e, ok := <-queue:
+			if !ok {
+				// workers are closed on shutdown, context may be canceled already
+				flush(context.WithoutCancel(ctx))
+				return
+			}
+
+			if o.window <= 0 {
+				o.apply(ctx, []changeEvent{e.ev})
+				continue
+			}
+
+			add(e)
+
+			if flushC == nil {
+				flushC = time.After(o.window)
+			}
+		case <-flushC:
+			flush(ctx)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OrderedWorkers(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Workers  int
+		Window   time.Duration
+		Excepted map[string][][]string
+	}{
+		{
+			Name:    "without window",
+			Workers: 4,
+			Excepted: map[string][][]string{
+				"a": {{"a1"}, {"a2"}, {"a3"}},
+				"b": {{"b1"}, {"b2"}},
+			},
+		},
+		{
+			Name:    "coalesce",
+			Workers: 2,
+			Window:  time.Hour,
+			Excepted: map[string][][]string{
+				"a": {{"a1", "a2", "a3"}},
+				"b": {{"b1", "b2"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var mu sync.Mutex
+			applied := make(map[string][][]string)
+
+			o := newOrderedWorkers(context.Background(), tt.Workers, tt.Window, func(_ context.Context, events []changeEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				names := make([]string, 0, len(events))
+				for _, ev := range events {
+					names = append(names, string(ev.res.ResumeToken))
+				}
+
+				key := keyString(events[0].res.DocumentId)
+				applied[key] = append(applied[key], names)
+			})
+
+			for _, name := range []string{"a1", "b1", "a2", "a3", "b2"} {
+				key := name[:1]
+				o.Push(context.Background(), key, changeEvent{
+					wType: database.OnUpdate,
+					res:   database.WatchResult{DocumentId: key, ResumeToken: []byte(name)},
+				})
+			}
+
+			// pending events are applied on close
+			o.Close()
+
+			assert.Equal(t, tt.Excepted, applied)
+		})
+	}
+}
+
+func Test_OrderedWorkersCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	applied := make(chan []changeEvent, 1)
+	o := newOrderedWorkers(ctx, 1, time.Hour, func(ctx context.Context, events []changeEvent) {
+		// pending events are applied with context which isn't canceled
+		assert.NoError(t, ctx.Err())
+		applied <- events
+	})
+
+	o.Push(ctx, "a", changeEvent{
+		wType: database.OnUpdate,
+		res:   database.WatchResult{DocumentId: "a", ResumeToken: []byte("a1")},
+	})
+
+	cancel()
+	o.Close()
+
+	select {
+	case events := <-applied:
+		assert.Len(t, events, 1)
+	default:
+		t.Fatal("pending events aren't applied on cancel")
+	}
+}
@@ -1,58 +1,418 @@
 package bridge
 
 import (
+	"container/heap"
 	"context"
+	"encoding/json"
+	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
 	"github.com/Ja7ad/meilibridge/pkg/types"
+	"math/rand/v2"
+	"sync"
 	"time"
 )
 
+const (
+	_queueBucket  = "trigger_queue"
+	_requeueDelay = 5 * time.Second
+)
+
+// Queue is write-ahead queue of trigger items, items are kept in store until
+// they're processed, so accepted items are replayed in order after restart.
+// Failed items are retried with exponential backoff and moved to dead letters
+// after max attempts. Items of same document are processed in order, later
+// items wait for retry of failed one, items of other documents don't.
 type Queue struct {
-	items chan types.TriggerRequestBody
-	log   logger.Logger
+	store       store.Store
+	notify      chan struct{}
+	maxAttempts int
+	retryDelay  time.Duration
+	maxDelay    time.Duration
+	log         logger.Logger
+
+	// index of store, it's loaded once and kept with store
+	mu      sync.Mutex
+	loaded  bool
+	docs    map[string][]*queued
+	ready   readyQueue
+	waiting waitingQueue
+}
+
+// queued is item of queue with its store key, only first item of document is
+// in ready or waiting queue.
+type queued struct {
+	key   string
+	doc   string
+	entry queueEntry
+}
+
+type queueEntry struct {
+	Item      types.TriggerRequestBody `json:"item"`
+	Attempts  int                      `json:"attempts"`
+	NotBefore time.Time                `json:"not_before"`
 }
 
-func newQueue(log logger.Logger) *Queue {
-	return &Queue{
-		items: make(chan types.TriggerRequestBody),
-		log:   log,
+func newQueue(st store.Store, retry *config.Retry, log logger.Logger) *Queue {
+	q := &Queue{
+		store:       st,
+		notify:      make(chan struct{}, 1),
+		maxAttempts: 0,
+		retryDelay:  _requeueDelay,
+		maxDelay:    _requeueDelay,
+		log:         log,
+		docs:        make(map[string][]*queued),
+	}
+
+	if retry != nil {
+		q.maxAttempts = retry.MaxAttempts
+		q.retryDelay = time.Duration(retry.InitialBackoff) * time.Second
+		q.maxDelay = time.Duration(retry.MaxBackoff) * time.Second
 	}
+
+	return q
 }
 
-func (q *Queue) Add(item types.TriggerRequestBody) {
-	q.items <- item
+// processFunc processes trigger item, returned write is done when item is
+// written. Failed item is retried if requeue is true.
+type processFunc func(ctx context.Context, i types.TriggerRequestBody) (w *batchWrite, requeue bool)
+
+func (q *Queue) Add(item types.TriggerRequestBody) error {
+	if err := q.push(queueEntry{Item: item}); err != nil {
+		return err
+	}
+
 	q.log.Info("add new item to queue",
 		"index", item.IndexUID,
 		"operation", item.Type,
-		"document", item.Document,
+		"document", queueDocument(item),
 	)
+
+	return nil
 }
 
-func (q *Queue) Process(ctx context.Context, processFunc func(ctx context.Context, i types.TriggerRequestBody) (bool, error)) {
+// AddAll adds items with one write of store, items are processed in their order.
+func (q *Queue) AddAll(items []types.TriggerRequestBody) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	entries := make([]queueEntry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, queueEntry{Item: item})
+	}
+
+	if err := q.push(entries...); err != nil {
+		return err
+	}
+
+	q.log.Info("add new items to queue", "items", len(items))
+
+	return nil
+}
+
+// Process processes ready items until ctx is canceled, it doesn't wait for
+// write of item, so items of other documents share batches of index. Next item
+// of document is ready when write of item is done.
+func (q *Queue) Process(ctx context.Context, process processFunc) {
 	for {
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil {
 			q.log.Info("stopping queue")
-			close(q.items)
 			return
-		case item := <-q.items:
-			requeue, err := processFunc(ctx, item)
-			if err != nil {
-				q.log.Error("failed to process item, requeue it after 5 second",
-					"index", item.IndexUID,
-					"operation", item.Type,
-					"document", item.Document,
-					"error", err,
-				)
-				if requeue {
-					go func(i types.TriggerRequestBody) {
-						time.Sleep(5 * time.Second)
-						q.Add(i)
-					}(item)
-				}
-			} else {
-				q.log.Info("processed item", "index", item.IndexUID, "operation", item.Type)
+		}
+
+		it, wait, err := q.next()
+		if err != nil {
+			q.log.Error("failed to read queue", "err", err)
+			wait = q.retryDelay
+		}
+
+		if it == nil {
+			select {
+			case <-ctx.Done():
+				q.log.Info("stopping queue")
+				return
+			case <-q.notify:
+			case <-time.After(wait):
 			}
+			continue
+		}
+
+		w, requeue := process(ctx, it.entry.Item)
+		w.Notify(func(err error) {
+			// store isn't written in submitter of batcher
+			go q.finish(ctx, it, requeue, err)
+		})
+	}
+}
+
+// finish removes written item or retries failed one.
+func (q *Queue) finish(ctx context.Context, it *queued, requeue bool, err error) {
+	item := it.entry.Item
+
+	if err != nil && ctx.Err() != nil {
+		// item stays in queue and is replayed on next start
+		return
+	}
+
+	if err == nil || !q.retry(it, requeue, err) {
+		if err == nil {
+			q.log.Info("processed item", "index", item.IndexUID, "operation", item.Type)
+		}
+		q.done(it)
+	}
+
+	q.wake()
+}
+
+// retry keeps failed item in its place with backoff, so later items of its
+// document wait for it. It returns false if item is moved to dead letters
+// because it can't be requeued or it reached max attempts.
+func (q *Queue) retry(it *queued, requeue bool, err error) bool {
+	entry := it.entry
+	item := entry.Item
+	entry.Attempts++
+
+	if !requeue || (q.maxAttempts > 0 && entry.Attempts >= q.maxAttempts) {
+		q.log.Error("failed to process item, moved to dead letters",
+			"index", item.IndexUID,
+			"operation", item.Type,
+			"document", queueDocument(item),
+			"attempts", entry.Attempts,
+			"error", err,
+		)
+
+		if err := addDeadLetter(q.store, entry, err); err != nil {
+			q.log.Error("failed to add dead letter", "index", item.IndexUID, "err", err)
+		}
+		return false
+	}
+
+	delay := q.backoff(entry.Attempts)
+
+	q.log.Error("failed to process item, requeue it",
+		"index", item.IndexUID,
+		"operation", item.Type,
+		"document", queueDocument(item),
+		"attempts", entry.Attempts,
+		"delay", delay.String(),
+		"error", err,
+	)
+
+	entry.NotBefore = time.Now().Add(delay)
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = q.store.Put(_queueBucket, it.key, data)
+	}
+	if err != nil {
+		// attempts aren't kept after restart, item is still retried
+		q.log.Error("failed to save requeued item", "index", item.IndexUID, "err", err)
+	}
+
+	q.mu.Lock()
+	it.entry = entry
+	q.scheduleLocked(it)
+	q.mu.Unlock()
+
+	return true
+}
+
+// done removes processed item, next item of its document becomes ready.
+func (q *Queue) done(it *queued) {
+	if err := q.store.Delete(_queueBucket, it.key); err != nil {
+		q.log.Error("failed to remove item from queue", "index", it.entry.Item.IndexUID, "err", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.docs[it.doc][1:]
+	if len(items) == 0 {
+		delete(q.docs, it.doc)
+		return
+	}
+
+	q.docs[it.doc] = items
+	q.scheduleLocked(items[0])
+}
+
+// backoff returns exponential delay of attempt with jitter, delay is between
+// half and full of backoff.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.retryDelay
+	for i := 1; i < attempt && d < q.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, q.maxDelay)
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+func (q *Queue) push(entries ...queueEntry) error {
+	values := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
 		}
+		values = append(values, data)
+	}
+
+	// item is indexed in order of its key, so appends are serialized
+	q.mu.Lock()
+	if err := q.loadLocked(); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+
+	keys, err := q.store.AppendAll(_queueBucket, values)
+	if err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	for i, key := range keys {
+		q.addLocked(key, entries[i])
 	}
+	q.mu.Unlock()
+
+	q.wake()
+
+	return nil
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next returns first ready item of queue, it stays first item of its document
+// until it's done. If no item is ready, it returns time until next retry.
+func (q *Queue) next() (*queued, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.loadLocked(); err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	for len(q.waiting) > 0 && !q.waiting[0].entry.NotBefore.After(now) {
+		heap.Push(&q.ready, heap.Pop(&q.waiting))
+	}
+
+	if len(q.ready) == 0 {
+		wait := q.maxDelay
+		if len(q.waiting) > 0 {
+			wait = q.waiting[0].entry.NotBefore.Sub(now)
+		}
+		return nil, wait, nil
+	}
+
+	return heap.Pop(&q.ready).(*queued), 0, nil
+}
+
+// loadLocked indexes items of store once, broken items can't be processed and
+// are dropped.
+func (q *Queue) loadLocked() error {
+	if q.loaded {
+		return nil
+	}
+
+	broken := make([]string, 0)
+
+	err := q.store.ForEach(_queueBucket, func(k string, data []byte) error {
+		var e queueEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			broken = append(broken, k)
+			return nil
+		}
+
+		q.addLocked(k, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range broken {
+		q.log.Error("drop broken item from queue", "key", k)
+		_ = q.store.Delete(_queueBucket, k)
+	}
+
+	q.loaded = true
+
+	return nil
+}
+
+func (q *Queue) addLocked(key string, entry queueEntry) {
+	it := &queued{key: key, doc: queueDocument(entry.Item), entry: entry}
+
+	q.docs[it.doc] = append(q.docs[it.doc], it)
+	if len(q.docs[it.doc]) == 1 {
+		q.scheduleLocked(it)
+	}
+}
+
+// scheduleLocked adds first item of document to ready or waiting queue.
+func (q *Queue) scheduleLocked(it *queued) {
+	if it.entry.NotBefore.After(time.Now()) {
+		heap.Push(&q.waiting, it)
+		return
+	}
+	heap.Push(&q.ready, it)
+}
+
+// queueDocument returns key of document of trigger item, items of same key are
+// processed in order.
+func queueDocument(item types.TriggerRequestBody) string {
+	doc := item.IndexUID + "/" + item.Source + "/"
+	if item.Document == nil {
+		return doc
+	}
+
+	if len(item.Document.Keys) > 0 {
+		// keys of map are sorted by json
+		data, _ := json.Marshal(item.Document.Keys)
+		return doc + string(data)
+	}
+
+	return doc + keyString(item.Document.PrimaryValue)
+}
+
+// readyQueue is heap of ready items in order of their store keys.
+type readyQueue []*queued
+
+func (r readyQueue) Len() int           { return len(r) }
+func (r readyQueue) Less(i, j int) bool { return r[i].key < r[j].key }
+func (r readyQueue) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r *readyQueue) Push(x any)        { *r = append(*r, x.(*queued)) }
+func (r *readyQueue) Pop() any {
+	old := *r
+	it := old[len(old)-1]
+	*r = old[:len(old)-1]
+	return it
+}
+
+// waitingQueue is heap of items waiting for retry in order of their retry time.
+type waitingQueue []*queued
+
+func (w waitingQueue) Len() int { return len(w) }
+func (w waitingQueue) Less(i, j int) bool {
+	return w[i].entry.NotBefore.Before(w[j].entry.NotBefore)
+}
+func (w waitingQueue) Swap(i, j int) { w[i], w[j] = w[j], w[i] }
+func (w *waitingQueue) Push(x any)   { *w = append(*w, x.(*queued)) }
+func (w *waitingQueue) Pop() any {
+	old := *w
+	it := old[len(old)-1]
+	*w = old[:len(old)-1]
+	return it
 }
@@ -0,0 +1,210 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
+	"github.com/Ja7ad/meilibridge/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_QueueReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	st, err := store.New(path)
+	require.NoError(t, err)
+
+	q := newQueue(st, nil, logger.DefaultLogger)
+	for _, uid := range []string{"idx1", "idx2", "idx3"} {
+		require.NoError(t, q.Add(types.TriggerRequestBody{
+			IndexUID: uid,
+			Type:     types.INSERT,
+			Document: &types.Document{PrimaryKey: "id", PrimaryValue: float64(1)},
+		}))
+	}
+	require.NoError(t, st.Close())
+
+	// items are replayed after restart
+	st, err = store.New(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	q = newQueue(st, nil, logger.DefaultLogger)
+	q.retryDelay = 10 * time.Millisecond
+	q.maxDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		failed    bool
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Process(ctx, func(_ context.Context, i types.TriggerRequestBody) (*batchWrite, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if i.IndexUID == "idx2" && !failed {
+				failed = true
+				return doneWrite(errors.New("failed")), true
+			}
+
+			processed = append(processed, i.IndexUID)
+			if len(processed) == 3 {
+				cancel()
+			}
+			return doneWrite(nil), true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue is not processed")
+	}
+
+	assert.Equal(t, []string{"idx1", "idx3", "idx2"}, processed)
+
+	// processed items are removed after their writes are done
+	assert.Eventually(t, func() bool {
+		_, _, err := st.First(_queueBucket)
+		return errors.Is(err, store.ErrNotFound)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func Test_QueueDeadLetter(t *testing.T) {
+	st := store.NewMemory()
+
+	q := newQueue(st, &config.Retry{MaxAttempts: 3}, logger.DefaultLogger)
+	q.retryDelay = time.Millisecond
+	q.maxDelay = 4 * time.Millisecond
+
+	require.NoError(t, q.Add(types.TriggerRequestBody{
+		IndexUID: "idx1",
+		Type:     types.DELETE,
+		Document: &types.Document{PrimaryKey: "id", PrimaryValue: "foo"},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go q.Process(ctx, func(context.Context, types.TriggerRequestBody) (*batchWrite, bool) {
+		return doneWrite(errors.New("failed")), true
+	})
+
+	var letters []*DeadLetter
+	require.Eventually(t, func() bool {
+		var err error
+		letters, err = ListDeadLetters(st)
+		require.NoError(t, err)
+		return len(letters) == 1
+	}, 4*time.Second, 5*time.Millisecond)
+	cancel()
+
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, "failed", letters[0].Error)
+	assert.Equal(t, "idx1", letters[0].Item.IndexUID)
+
+	dl, err := GetDeadLetter(st, letters[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, letters[0], dl)
+
+	require.NoError(t, ReplayDeadLetter(st, dl.ID))
+
+	_, err = GetDeadLetter(st, dl.ID)
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	_, value, err := st.First(_queueBucket)
+	require.NoError(t, err)
+	assert.Contains(t, string(value), `"attempts":0`)
+}
+
+func Test_QueueBackoff(t *testing.T) {
+	q := newQueue(store.NewMemory(), &config.Retry{
+		MaxAttempts:    5,
+		InitialBackoff: 2,
+		MaxBackoff:     10,
+	}, logger.DefaultLogger)
+
+	tests := []struct {
+		Attempt int
+		Max     time.Duration
+	}{
+		{Attempt: 1, Max: 2 * time.Second},
+		{Attempt: 2, Max: 4 * time.Second},
+		{Attempt: 3, Max: 8 * time.Second},
+		{Attempt: 4, Max: 10 * time.Second},
+		{Attempt: 10, Max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		d := q.backoff(tt.Attempt)
+		assert.GreaterOrEqual(t, d, tt.Max/2)
+		assert.LessOrEqual(t, d, tt.Max)
+	}
+}
+
+func Test_QueueDocumentOrder(t *testing.T) {
+	q := newQueue(store.NewMemory(), nil, logger.DefaultLogger)
+	q.retryDelay = 10 * time.Millisecond
+	q.maxDelay = 10 * time.Millisecond
+
+	items := []types.TriggerRequestBody{
+		{IndexUID: "idx1", Type: types.INSERT, Document: &types.Document{PrimaryKey: "id", PrimaryValue: "1"}},
+		{IndexUID: "idx1", Type: types.UPDATE, Document: &types.Document{PrimaryKey: "id", PrimaryValue: "1"}},
+		{IndexUID: "idx1", Type: types.INSERT, Document: &types.Document{PrimaryKey: "id", PrimaryValue: "2"}},
+	}
+	for _, item := range items {
+		require.NoError(t, q.Add(item))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		processed []string
+		failed    bool
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Process(ctx, func(_ context.Context, i types.TriggerRequestBody) (*batchWrite, bool) {
+			name := fmt.Sprintf("%v:%s", i.Document.PrimaryValue, i.Type)
+
+			// update of document 1 waits for retry of its insert
+			if name == "1:INSERT" && !failed {
+				failed = true
+				return doneWrite(errors.New("failed")), true
+			}
+
+			processed = append(processed, name)
+			if len(processed) == 3 {
+				cancel()
+			}
+			return doneWrite(nil), true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue is not processed")
+	}
+
+	assert.Equal(t, []string{"2:INSERT", "1:INSERT", "1:UPDATE"}, processed)
+}
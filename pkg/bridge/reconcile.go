@@ -0,0 +1,145 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	_reconcileLimit       = int64(1000)
+	_reconcileReportLimit = 100
+)
+
+// existsFunc returns primary keys of keys which exist in source.
+type existsFunc func(ctx context.Context, keys []any) ([]any, error)
+
+// existsAny returns keys which exist in any of sources.
+func existsAny(exists []existsFunc) existsFunc {
+	if len(exists) == 1 {
+		return exists[0]
+	}
+
+	return func(ctx context.Context, keys []any) ([]any, error) {
+		found := make([]any, 0, len(keys))
+		for _, fn := range exists {
+			res, err := fn(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, res...)
+		}
+		return found, nil
+	}
+}
+
+type reconcileReport struct {
+	index   string
+	checked int64
+	orphans []string
+}
+
+// reconcile pages primary keys of index, checks them in source and deletes documents
+// which no longer exist in source, with dry run orphans are only reported.
+func reconcile(
+	ctx context.Context,
+	m meilisearch.Meilisearch,
+	indexName, primaryKey string,
+	exists existsFunc,
+	dryRun bool,
+) (*reconcileReport, error) {
+	idx := m.Index(indexName)
+	report := &reconcileReport{index: indexName, orphans: make([]string, 0)}
+
+	for offset := int64(0); ; offset += _reconcileLimit {
+		keys, err := m.DocumentKeys(ctx, indexName, primaryKey, offset, _reconcileLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+
+		found, err := exists(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		existing := make(map[string]struct{}, len(found))
+		for _, v := range found {
+			existing[keyString(v)] = struct{}{}
+		}
+
+		for _, v := range keys {
+			if _, ok := existing[keyString(v)]; !ok {
+				report.orphans = append(report.orphans, keyString(v))
+			}
+		}
+
+		report.checked += int64(len(keys))
+
+		if int64(len(keys)) < _reconcileLimit {
+			break
+		}
+	}
+
+	// deleting after scan, deleting while paging by offset skips documents
+	if dryRun || len(report.orphans) == 0 {
+		return report, nil
+	}
+
+	for i := 0; i < len(report.orphans); i += int(_reconcileLimit) {
+		end := min(i+int(_reconcileLimit), len(report.orphans))
+
+		t, err := idx.DeleteDocumentsWithContext(ctx, report.orphans[i:end])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := m.WaitForTask(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// keyString normalizes primary key of source and index for comparing, index
+// numbers are decoded as float64.
+func keyString(v any) string {
+	switch k := v.(type) {
+	case string:
+		return k
+	case float64:
+		return strconv.FormatFloat(k, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(k), 'f', -1, 32)
+	case []byte:
+		return string(k)
+	case primitive.ObjectID, primitive.Binary:
+		return keyString(encodeID(k))
+	default:
+		return fmt.Sprint(k)
+	}
+}
+
+func logReconcileReport(ctx context.Context, log logger.Logger, name string, report *reconcileReport, dryRun bool) {
+	orphans := report.orphans
+	if len(orphans) > _reconcileReportLimit {
+		orphans = orphans[:_reconcileReportLimit]
+	}
+
+	log.InfoContext(ctx, "reconcile report",
+		"bridge", name,
+		"index", report.index,
+		"checked", report.checked,
+		"orphans", len(report.orphans),
+		"dry_run", dryRun,
+		"keys", orphans,
+	)
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
+	meili "github.com/meilisearch/meilisearch-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeMeili struct {
+	meilisearch.Meilisearch
+	idx *fakeIndex
+}
+
+func (f *fakeMeili) Index(string) meili.IndexManager {
+	return f.idx
+}
+
+func (f *fakeMeili) WaitForTask(context.Context, *meili.TaskInfo) error {
+	return nil
+}
+
+func (f *fakeMeili) IsExistsIndex(context.Context, string) bool {
+	return true
+}
+
+func (f *fakeMeili) DocumentKeys(_ context.Context, _, _ string, offset, limit int64) ([]any, error) {
+	start := min(offset, int64(len(f.idx.keys)))
+	end := min(offset+limit, int64(len(f.idx.keys)))
+	return f.idx.keys[start:end], nil
+}
+
+type fakeIndex struct {
+	meili.IndexManager
+	keys     []any
+	deleted  []string
+	replaced []*database.Result
+}
+
+func (f *fakeIndex) AddDocumentsWithContext(_ context.Context, docs interface{}, _ ...string) (*meili.TaskInfo, error) {
+	f.replaced = append(f.replaced, docs.([]*database.Result)...)
+	return &meili.TaskInfo{}, nil
+}
+
+func (f *fakeIndex) DeleteDocumentsWithContext(_ context.Context, ids []string) (*meili.TaskInfo, error) {
+	f.deleted = append(f.deleted, ids...)
+	return &meili.TaskInfo{}, nil
+}
+
+func Test_Reconcile(t *testing.T) {
+	keys := make([]any, 0)
+	for i := 1; i <= 2500; i++ {
+		keys = append(keys, int64(i))
+	}
+
+	// ids which float64 can't keep, second one is lost in source
+	keys = append(keys, int64(9007199254740993), int64(9007199254740995))
+
+	// source lost every 1000th row
+	exists := func(_ context.Context, keys []any) ([]any, error) {
+		found := make([]any, 0, len(keys))
+		for _, k := range keys {
+			if k.(int64)%1000 != 0 && k.(int64) != 9007199254740995 {
+				found = append(found, k)
+			}
+		}
+		return found, nil
+	}
+
+	orphans := []string{"1000", "2000", "9007199254740995"}
+
+	tests := []struct {
+		Name    string
+		DryRun  bool
+		Deleted []string
+	}{
+		{
+			Name:    "dry run",
+			DryRun:  true,
+			Deleted: nil,
+		},
+		{
+			Name:    "delete",
+			DryRun:  false,
+			Deleted: orphans,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			idx := &fakeIndex{keys: keys}
+
+			report, err := reconcile(context.Background(), &fakeMeili{idx: idx}, "idx1", "id", exists, tt.DryRun)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2502), report.checked)
+			assert.Equal(t, orphans, report.orphans)
+			assert.Equal(t, tt.Deleted, idx.deleted)
+		})
+	}
+}
+
+func Test_KeyString(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	tests := []struct {
+		Name     string
+		Key      any
+		Excepted string
+	}{
+		{Name: "float", Key: float64(12345678901), Excepted: "12345678901"},
+		{Name: "int", Key: int64(12345678901), Excepted: "12345678901"},
+		{Name: "bytes", Key: []byte("foo"), Excepted: "foo"},
+		{Name: "object id", Key: oid, Excepted: oid.Hex()},
+		{Name: "binary", Key: primitive.Binary{Data: []byte{0xca, 0xfe}}, Excepted: "cafe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, keyString(tt.Key))
+		})
+	}
+}
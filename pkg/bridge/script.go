@@ -0,0 +1,100 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/script"
+)
+
+// _scripts keeps compiled scripts by path and timeout, scripts are compiled once
+// and shared by all syncers.
+var _scripts sync.Map
+
+type scriptKey struct {
+	path    string
+	timeout int64
+}
+
+func loadScript(cfg *config.Script) (*script.Script, error) {
+	key := scriptKey{path: cfg.Path, timeout: cfg.Timeout}
+	if s, ok := _scripts.Load(key); ok {
+		return s.(*script.Script), nil
+	}
+
+	s, err := script.New(cfg.Path, time.Duration(cfg.Timeout)*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load script %s: %w", cfg.Path, err)
+	}
+
+	actual, _ := _scripts.LoadOrStore(key, s)
+	return actual.(*script.Script), nil
+}
+
+// loadScripts compiles scripts of indexes, so broken script fails on start.
+func loadScripts(tasks []task) error {
+	for _, t := range tasks {
+		if t.des.Script == nil {
+			continue
+		}
+
+		if _, err := loadScript(t.des.Script); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipScriptError logs document which script fails for in bulk sync, document
+// isn't indexed and sync goes on.
+func skipScriptError(log logger.Logger, des *config.IndexConfig) func(doc database.Result, err error) {
+	return func(doc database.Result, err error) {
+		log.Error("skip document which script failed for",
+			"index", des.IndexName,
+			"document", doc[des.PrimaryKey],
+			"err", err.Error(),
+		)
+	}
+}
+
+// runScript runs script for every document, document which script fails for is
+// passed to skip if it's set, otherwise error of script fails all documents.
+func runScript(
+	ctx context.Context,
+	results []*database.Result,
+	cfg *config.Script,
+	skip func(doc database.Result, err error),
+) ([]*database.Result, error) {
+	s, err := loadScript(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*database.Result, 0, len(results))
+
+	for _, res := range results {
+		out, err := s.Run(ctx, *res)
+		if err != nil {
+			err = fmt.Errorf("script %s: %w", cfg.Path, err)
+			if skip == nil || ctx.Err() != nil {
+				return nil, err
+			}
+
+			skip(*res, err)
+			continue
+		}
+
+		for _, o := range out {
+			doc := database.Result(o)
+			docs = append(docs, &doc)
+		}
+	}
+
+	return docs, nil
+}
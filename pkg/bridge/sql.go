@@ -5,22 +5,30 @@ import (
 	"fmt"
 	"github.com/Ja7ad/meilibridge/pkg/types"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/database"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"github.com/Ja7ad/meilibridge/pkg/meilisearch"
+	meili "github.com/meilisearch/meilisearch-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type sql struct {
 	name         string
 	executor     database.SQLExecutor
-	indexMap     map[config.Collection]*config.IndexConfig
+	tasks        []task
 	meili        meilisearch.Meilisearch
 	triggerToken string
 	queue        *Queue
+	checkpoint   *checkpoint
 	log          logger.Logger
+	batchers     batchers
+
+	// watches is changes of tables subscribed before snapshot by checkpoint key of task
+	watches map[string]<-chan func() (database.WatcherType, database.WatchResult)
 }
 
 func (s *sql) Name() string {
@@ -31,24 +39,290 @@ func (s *sql) Trigger() http.HandlerFunc {
 	return triggerHandler(s.triggerToken, s.queue)
 }
 
-func (s *sql) OnDemand(_ context.Context) {
-	s.log.Warn("currently not support real-time sync for sql, " +
-		"you can use bulk sync with --continue with scheduler.")
-	return
+func (s *sql) BatchTrigger() http.HandlerFunc {
+	return batchTriggerHandler(s.triggerToken, s.queue, s.validateTrigger)
 }
 
-func (s *sql) Bulk(ctx context.Context, isContinue bool) {
+// validateTrigger returns error of item which can't be processed, so it isn't queued.
+func (s *sql) validateTrigger(item types.TriggerRequestBody) error {
+	if err := item.Validate(); err != nil {
+		return err
+	}
+
+	t, err := findTask(s.tasks, item.IndexUID, item.Source)
+	if err != nil {
+		return err
+	}
+
+	if _, err := triggerQuery(t.des, item); err != nil {
+		return err
+	}
+
+	_, err = triggerID(t.des, item)
+	return err
+}
+
+func (s *sql) OnDemand(ctx context.Context, opts SyncOptions) {
 	var wg sync.WaitGroup
-	taskCh := make(chan task, len(s.indexMap))
-	statCh := make(chan stat, len(s.indexMap))
+	taskCh := make(chan task, len(s.tasks))
 
-	for i := 0; i < len(s.indexMap); i++ {
+	if opts.Snapshot {
+		if err := s.snapshot(ctx); err != nil {
+			s.log.Error(err.Error())
+			return
+		}
+	}
+
+	if s.checkpoint != nil {
 		wg.Add(1)
-		go s.bulkWorker(ctx, &wg, taskCh, statCh, isContinue)
+		go func() {
+			defer wg.Done()
+			s.checkpoint.Run(ctx)
+		}()
 	}
 
-	for col, des := range s.indexMap {
-		taskCh <- task{col: col, des: des}
+	for i := 0; i < len(s.tasks); i++ {
+		wg.Add(1)
+		go s.onDemandWorker(ctx, &wg, taskCh)
+	}
+
+	for _, t := range s.tasks {
+		taskCh <- t
+	}
+	close(taskCh)
+
+	wg.Wait()
+	s.batchers.Close()
+
+	// position confirmed by writes finished on shutdown
+	if s.checkpoint != nil {
+		s.checkpoint.flush()
+	}
+}
+
+func (s *sql) onDemandWorker(ctx context.Context, wg *sync.WaitGroup, taskCh <-chan task) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-taskCh:
+			if !ok {
+				return
+			}
+
+			if err := s.handleTask(ctx, t); err != nil {
+				s.log.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (s *sql) handleTask(ctx context.Context, t task) error {
+	table, source := t.col.String(), t.col.String()
+	if t.col.HasView() {
+		table, source = t.col.GetCollectionAndView()
+	}
+	source = sqlSource(source, t.des)
+
+	if !s.meili.IsExistsIndex(ctx, t.des.IndexName) {
+		if err := recreateIndex(ctx, t.des.IndexName, t.des.PrimaryKey, t.des.Settings, s.meili); err != nil {
+			return err
+		}
+	}
+
+	watch, ok := s.watches[checkpointKey(t)]
+	if !ok {
+		var err error
+		watch, err = s.executor.Watcher(ctx, table, s.checkpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	idx := s.meili.Index(t.des.IndexName)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case w, ok := <-watch:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				// stream stops when a change of it isn't written
+				return fmt.Errorf("stream of table %s is stopped, index %s isn't synced", table, t.des.IndexName)
+			}
+
+			wType, res := w()
+			s.handleWatchEvent(ctx, idx, t, wType, res, source).Notify(func(err error) {
+				if err != nil {
+					s.log.Error(err.Error())
+				}
+
+				// position of stream passes change after it's written
+				if res.Ack != nil {
+					res.Ack(err)
+				}
+			})
+		}
+	}
+}
+
+// snapshot subscribes to changes of tables and loads indexes with bulk sync,
+// changes during bulk wait in stream and are applied after it. Changed rows are
+// read back from source, so applying them again doesn't break order.
+func (s *sql) snapshot(ctx context.Context) error {
+	s.watches = make(map[string]<-chan func() (database.WatcherType, database.WatchResult))
+
+	for _, t := range s.tasks {
+		table := t.col.String()
+		if t.col.HasView() {
+			table, _ = t.col.GetCollectionAndView()
+		}
+
+		watch, err := s.executor.Watcher(ctx, table, s.checkpoint)
+		if err != nil {
+			return err
+		}
+		s.watches[checkpointKey(t)] = watch
+	}
+
+	for _, tasks := range groupTasks(s.tasks) {
+		if s.snapshotDone(tasks) {
+			continue
+		}
+
+		s.log.InfoContext(ctx, "loading snapshot of index", "index", tasks[0].des.IndexName)
+
+		// stream has no operation time, snapshot is marked by its finish time
+		ts := primitive.Timestamp{T: uint32(time.Now().Unix())}
+
+		if err := s.bulkIndex(ctx, tasks, BulkOptions{Swap: true}, nil); err != nil {
+			return fmt.Errorf("failed to load snapshot of index %s: %w", tasks[0].des.IndexName, err)
+		}
+
+		for _, t := range tasks {
+			if err := s.checkpoint.SaveSnapshot(checkpointKey(t), ts); err != nil {
+				return fmt.Errorf("failed to save snapshot of index %s: %w", tasks[0].des.IndexName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// snapshotDone returns true if snapshot of all tasks is finished before, their
+// changes since then are read from saved position of stream.
+func (s *sql) snapshotDone(tasks []task) bool {
+	for _, t := range tasks {
+		if _, ok := s.checkpoint.LoadSnapshot(checkpointKey(t)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// handleWatchEvent applies row event of table to index, inserted and updated rows
+// are read back from source (table or view) to keep documents same as bulk sync.
+// Returned write is done when change is written to index.
+func (s *sql) handleWatchEvent(
+	ctx context.Context,
+	idx meili.IndexManager,
+	t task,
+	wType database.WatcherType,
+	res database.WatchResult,
+	source string,
+) *batchWrite {
+	query, ok := keyQuery(t.des, res.Document)
+	if !ok {
+		return doneWrite(fmt.Errorf("primary key %s not found in %s event of %s",
+			strings.Join(sourceKeys(t.des), ", "), wType, t.col))
+	}
+
+	id, err := documentID(t.des, query)
+	if err != nil {
+		return doneWrite(err)
+	}
+
+	b := s.batchers.get(ctx, idx, t.des, s.meili.WaitForTask, s.log)
+
+	switch wType {
+	case database.OnInsert, database.OnUpdate:
+		s.log.InfoContext(ctx, fmt.Sprintf("%s document %s", wType, id),
+			"table", t.col, "index", t.des.IndexName)
+
+		// document of old key is removed when key of row is changed, change is
+		// done when both writes are done
+		del := doneWrite(nil)
+		if oldID, ok := s.changedID(t, res, id); ok {
+			del = b.Delete(oldID)
+		}
+
+		doc, err := s.executor.FindOne(ctx, source, query, sqlFilter(t.des))
+		if err != nil {
+			return joinWrites(del, doneWrite(fmt.Errorf("failed to find document %s in %s: %w", id, t.col, err)))
+		}
+
+		if doc == nil {
+			if t.des.Filter == nil {
+				return del
+			}
+
+			// row doesn't match filter of index anymore
+			return joinWrites(del, b.Delete(id))
+		}
+
+		docs, err := mapDocuments(ctx, []*database.Result{&doc}, t.des)
+		if err != nil {
+			return joinWrites(del, doneWrite(fmt.Errorf("failed to map document of index %s: %w", t.des.IndexName, err)))
+		}
+
+		return joinWrites(del, b.Replace(docs))
+	case database.OnDelete:
+		s.log.InfoContext(ctx, fmt.Sprintf("remove document %s", id),
+			"table", t.col, "index", t.des.IndexName)
+
+		return b.Delete(id)
+	}
+
+	return doneWrite(nil)
+}
+
+// changedID returns id of document before update if key of row is changed.
+func (s *sql) changedID(t task, res database.WatchResult, id string) (string, bool) {
+	if res.Before == nil {
+		return "", false
+	}
+
+	query, ok := keyQuery(t.des, res.Before)
+	if !ok {
+		return "", false
+	}
+
+	oldID, err := documentID(t.des, query)
+	if err != nil || oldID == id {
+		return "", false
+	}
+
+	return oldID, true
+}
+
+func (s *sql) Bulk(ctx context.Context, opts BulkOptions) {
+	var wg sync.WaitGroup
+	groups := groupTasks(s.tasks)
+	taskCh := make(chan []task, len(groups))
+	statCh := make(chan stat, len(s.tasks))
+
+	for i := 0; i < len(groups); i++ {
+		wg.Add(1)
+		go s.bulkWorker(ctx, &wg, taskCh, statCh, opts)
+	}
+
+	for _, g := range groups {
+		taskCh <- g
 	}
 	close(taskCh)
 
@@ -81,115 +355,266 @@ func (s *sql) Bulk(ctx context.Context, isContinue bool) {
 
 func (s *sql) bulkWorker(ctx context.Context,
 	wg *sync.WaitGroup,
-	taskCh <-chan task,
+	taskCh <-chan []task,
 	statCh chan<- stat,
-	isContinue bool,
+	opts BulkOptions,
 ) {
 	defer wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case t, ok := <-taskCh:
+		case tasks, ok := <-taskCh:
 			if !ok {
 				return
 			}
 
-			table := t.col.String()
-
-			if t.col.HasView() {
-				_, table = t.col.GetCollectionAndView()
-			}
-
-			count, err := s.executor.Count(ctx, table)
-			if err != nil {
+			if err := s.bulkIndex(ctx, tasks, opts, statCh); err != nil {
 				statCh <- stat{err: err}
 				return
 			}
+		}
+	}
+}
 
-			if !isContinue {
-				if err := recreateIndex(ctx,
-					t.des.IndexName,
-					t.des.PrimaryKey,
-					t.des.Settings,
-					s.meili); err != nil {
-					s.log.Fatal("failed to recreate index", "err", err)
-				}
-			} else {
-				if !s.meili.IsExistsIndex(ctx, t.des.IndexName) {
-					s.log.Fatal(fmt.Sprintf("index %s does not exist for resync", t.des.IndexName))
-				}
+// bulkIndex syncs rows of tables of tasks to their shared index, progress is
+// reported to statCh if it's not nil.
+func (s *sql) bulkIndex(ctx context.Context, tasks []task, opts BulkOptions, statCh chan<- stat) error {
+	des := tasks[0].des
+
+	target, err := prepareBulkIndex(ctx, s.meili, des, opts)
+	if err != nil {
+		return err
+	}
+
+	marks := make([]any, len(tasks))
+	for i, t := range tasks {
+		table := t.col.String()
+
+		if t.col.HasView() {
+			_, table = t.col.GetCollectionAndView()
+		}
+		table = sqlSource(table, t.des)
+
+		marks[i], err = s.fillIndex(ctx, t, table, target, checkpointKey(t), opts.Continue, statCh)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && target != des.IndexName {
+		err = swapIndex(ctx, s.meili, des.IndexName, target, des.PrimaryKey)
+	}
+	if err != nil {
+		if target != des.IndexName {
+			dropIndex(ctx, s.meili, target, s.log)
+		}
+		return err
+	}
+
+	for i, t := range tasks {
+		if err := s.checkpoint.SaveWatermark(checkpointKey(t), marks[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fillIndex pushes rows of table to target index and returns high-water mark
+// of incremental index.
+func (s *sql) fillIndex(
+	ctx context.Context,
+	t task,
+	table, target, key string,
+	isContinue bool,
+	statCh chan<- stat,
+) (any, error) {
+	count, err := s.executor.Count(ctx, table, sqlFilter(t.des))
+	if err != nil {
+		return nil, err
+	}
+
+	since, mark, err := s.watermark(ctx, t, table, key, isContinue)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := s.meili.Index(target)
+	cur, err := s.executor.FindLimit(ctx, table, sourceKeys(t.des), _bulkLimit, since, sqlFilter(t.des))
+	if err != nil {
+		return nil, err
+	}
+
+	totalIndexed := int64(0)
+
+	for cur.Next(ctx) {
+		items, err := cur.Result()
+		if err != nil {
+			return nil, err
+		}
+
+		items, err = mapDocumentsSkip(ctx, items, t.des, skipScriptError(s.log, t.des))
+		if err != nil {
+			return nil, err
+		}
+
+		tsk, err := idx.UpdateDocuments(&items)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.meili.WaitForTask(ctx, tsk); err != nil {
+			return nil, err
+		}
+
+		totalIndexed += int64(len(items))
+
+		if statCh != nil {
+			col := table
+			if t.des.Query != nil {
+				col = t.col.String()
 			}
 
-			idx := s.meili.Index(t.des.IndexName)
-			cur, err := s.executor.FindLimit(ctx, table, _bulkLimit)
-			if err != nil {
-				statCh <- stat{err: err}
-				return
+			statCh <- stat{
+				col:     col,
+				index:   t.des.IndexName,
+				total:   count,
+				indexed: totalIndexed,
+				err:     nil,
 			}
+		}
+	}
 
-			totalIndexed := int64(0)
+	if _, err := cur.Result(); err != nil {
+		return nil, err
+	}
 
-			for cur.Next(ctx) {
-				items, err := cur.Result()
-				if err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	return mark, nil
+}
 
-				updateItemKeys(items, t.des.Fields)
+// watermark returns cursor watermark from last successful run and high-water mark
+// of current run for incremental index.
+func (s *sql) watermark(
+	ctx context.Context,
+	t task,
+	table, key string,
+	isContinue bool,
+) (*database.Watermark, any, error) {
+	if t.des.Incremental == nil {
+		return nil, nil, nil
+	}
 
-				tsk, err := idx.UpdateDocuments(&items)
-				if err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	// high-water mark is taken before sync, rows changed during sync are sent again on next run
+	mark, err := s.executor.Max(ctx, table, t.des.Incremental.Column)
+	if err != nil {
+		return nil, nil, err
+	}
 
-				if err := s.meili.WaitForTask(ctx, tsk); err != nil {
-					statCh <- stat{err: err}
-					return
-				}
+	if !isContinue {
+		return nil, mark, nil
+	}
 
-				totalIndexed += int64(len(items))
+	last, err := s.checkpoint.LoadWatermark(key)
+	if err != nil {
+		return nil, nil, err
+	}
 
-				statCh <- stat{
-					col:     table,
-					index:   t.des.IndexName,
-					total:   count,
-					indexed: totalIndexed,
-					err:     nil,
-				}
+	return &database.Watermark{Column: t.des.Incremental.Column, Value: last}, mark, nil
+}
+
+func (s *sql) Reconcile(ctx context.Context, dryRun bool) error {
+	for _, tasks := range groupTasks(s.tasks) {
+		des := tasks[0].des
+
+		if !s.meili.IsExistsIndex(ctx, des.IndexName) {
+			continue
+		}
+
+		// built key can't be looked up in source
+		if des.Key != nil {
+			s.log.WarnContext(ctx, "reconcile is skipped for index with key columns", "index", des.IndexName)
+			continue
+		}
+
+		// document of index of many sources exists if any source has it
+		exists := make([]existsFunc, 0, len(tasks))
+		for _, t := range tasks {
+			table := t.col.String()
+
+			if t.col.HasView() {
+				_, table = t.col.GetCollectionAndView()
 			}
+			table = sqlSource(table, t.des)
+
+			pk, filter := sourcePrimaryKey(t.des), sqlFilter(t.des)
+			exists = append(exists, func(ctx context.Context, keys []any) ([]any, error) {
+				return s.executor.Exists(ctx, table, pk, keys, filter)
+			})
 		}
+
+		report, err := reconcile(ctx, s.meili, des.IndexName, des.PrimaryKey, existsAny(exists), dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to reconcile index %s: %w", des.IndexName, err)
+		}
+
+		logReconcileReport(ctx, s.log, s.name, report, dryRun)
 	}
+
+	return nil
 }
 
-func (s *sql) processTrigger(ctx context.Context, item types.TriggerRequestBody) (bool, error) {
-	table, idx := indexConfigByUID(item.IndexUID, s.indexMap)
-	if idx == nil {
-		return false, fmt.Errorf("invalid index UID %s", item.IndexUID)
+func (s *sql) processTrigger(ctx context.Context, item types.TriggerRequestBody) (*batchWrite, bool) {
+	t, err := findTask(s.tasks, item.IndexUID, item.Source)
+	if err != nil {
+		return doneWrite(err), false
+	}
+	table, idx := t.col.GetView(), t.des
+
+	query, err := triggerQuery(idx, item)
+	if err != nil {
+		return doneWrite(err), false
+	}
+
+	id, err := triggerID(idx, item)
+	if err != nil {
+		return doneWrite(err), false
 	}
 
 	if !s.meili.IsExistsIndex(ctx, idx.IndexName) {
 		if err := recreateIndex(ctx, idx.IndexName, idx.PrimaryKey, idx.Settings, s.meili); err != nil {
-			return true, err
+			return doneWrite(err), true
 		}
 	}
 
-	res, err := s.executor.FindOne(ctx, table, map[string]any{item.Document.PrimaryKey: item.Document.PrimaryValue})
-	if err != nil {
-		return true, err
+	typ := item.Type
+
+	res, ok := inlineDocument(item)
+	if !ok && typ != types.DELETE {
+		res, err = s.executor.FindOne(ctx, sqlSource(table, idx), query, sqlFilter(idx))
+		if err != nil {
+			return doneWrite(err), true
+		}
+
+		// row doesn't match filter of index anymore
+		if res == nil && idx.Filter != nil {
+			typ = types.DELETE
+		}
 	}
 
-	if err := processTrigger(ctx,
-		s.meili.WaitForTask,
-		s.meili.Index(item.IndexUID),
-		item.Type,
-		res,
-		fmt.Sprintf("%v", item.Document.PrimaryValue),
-	); err != nil {
-		return true, err
+	// deleted or not found row has nothing to map
+	var docs []*database.Result
+	if typ != types.DELETE && res != nil {
+		docs, err = mapDocuments(ctx, []*database.Result{&res}, idx)
+		if err != nil {
+			return doneWrite(err), true
+		}
 	}
 
-	return false, nil
+	return processTrigger(
+		s.batchers.get(ctx, s.meili.Index(item.IndexUID), idx, s.meili.WaitForTask, s.log),
+		typ,
+		docs,
+		id,
+	), true
 }
@@ -0,0 +1,343 @@
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// _dateLayouts are tried for string dates if layout of transform doesn't match.
+var _dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// MapDocuments applies mapping of index to documents like sync, so mapping and
+// script of index can be tested against sample documents.
+func MapDocuments(ctx context.Context, docs []map[string]any, des *config.IndexConfig) ([]*database.Result, error) {
+	results := make([]*database.Result, 0, len(docs))
+	for _, doc := range docs {
+		res := database.Result(doc)
+		results = append(results, &res)
+	}
+
+	return mapDocuments(ctx, results, des)
+}
+
+// mapDocuments applies fields mapping, flatten, transforms and script of index to
+// documents and returns documents to push, script can drop or fan out documents.
+func mapDocuments(ctx context.Context, results []*database.Result, des *config.IndexConfig) ([]*database.Result, error) {
+	return mapDocumentsSkip(ctx, results, des, nil)
+}
+
+// mapDocumentsSkip is mapDocuments which drops documents script fails for and
+// passes them to skip, so one broken document doesn't fail others.
+func mapDocumentsSkip(
+	ctx context.Context,
+	results []*database.Result,
+	des *config.IndexConfig,
+	skip func(doc database.Result, err error),
+) ([]*database.Result, error) {
+	// _id is encoded first, so bulk and real-time sync push same primary key
+	for i := range results {
+		if id, ok := (*results[i])["_id"]; ok {
+			(*results[i])["_id"] = encodeID(id)
+		}
+	}
+
+	// key is built from source columns, so it's taken before fields mapping
+	var keys []string
+	if des.Key != nil {
+		keys = make([]string, len(results))
+		for i := range results {
+			key, err := encodeKey(des.Key, *results[i])
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = key
+		}
+	}
+
+	updateItemKeys(results, des.Fields)
+
+	for i, key := range keys {
+		(*results[i])[des.PrimaryKey] = key
+	}
+
+	if des.Flatten != nil {
+		for i := range results {
+			flattenDocument(*results[i], des.Flatten.Separator)
+		}
+	}
+
+	transformDocuments(results, des.Transforms)
+
+	if des.Script != nil {
+		var err error
+		results, err = runScript(ctx, results, des.Script, skip)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// discriminator is written last, so script can't drop it
+	if des.Discriminator != nil {
+		for i := range results {
+			(*results[i])[des.Discriminator.Field] = des.Discriminator.Value
+		}
+	}
+
+	return results, nil
+}
+
+// transformDocuments applies transforms to documents in order, values which
+// can't be converted are kept as is. Transforms are idempotent, so applying them
+// to already transformed document doesn't change it.
+func transformDocuments(results []*database.Result, transforms []*config.Transform) {
+	if len(transforms) == 0 {
+		return
+	}
+
+	for i := range results {
+		doc := *results[i]
+
+		for _, t := range transforms {
+			applyTransform(doc, t)
+		}
+	}
+}
+
+func applyTransform(doc database.Result, t *config.Transform) {
+	switch t.Type {
+	case config.DROP_NULL:
+		if t.Field != "" {
+			if v, ok := doc[t.Field]; ok && v == nil {
+				delete(doc, t.Field)
+			}
+			return
+		}
+
+		for k, v := range doc {
+			if v == nil {
+				delete(doc, k)
+			}
+		}
+	case config.DEFAULT:
+		if v, ok := doc[t.Field]; !ok || v == nil {
+			doc[t.Field] = t.Value
+		}
+	case config.CONCAT:
+		parts := make([]string, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			if v, ok := doc[f]; ok && v != nil {
+				parts = append(parts, toString(v))
+			}
+		}
+		doc[t.Field] = strings.Join(parts, t.Separator)
+	case config.LOWERCASE:
+		if s, ok := doc[t.Field].(string); ok {
+			doc[t.Field] = strings.ToLower(s)
+		}
+	case config.TRIM:
+		if s, ok := doc[t.Field].(string); ok {
+			doc[t.Field] = strings.TrimSpace(s)
+		}
+	case config.TIMESTAMP:
+		v, ok := doc[t.Field]
+		if !ok || v == nil {
+			return
+		}
+
+		if ts, ok := toTimestamp(v, t.Layout); ok {
+			doc[t.Field] = ts
+		}
+	case config.CAST:
+		v, ok := doc[t.Field]
+		if !ok || v == nil {
+			return
+		}
+
+		if c, ok := cast(v, t.To); ok {
+			doc[t.Field] = c
+		}
+	}
+}
+
+func cast(v any, to string) (any, bool) {
+	switch to {
+	case "string":
+		return toString(v), true
+	case "int":
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, false
+		}
+		return int64(f), true
+	case "float":
+		return toFloat(v)
+	case "bool":
+		switch b := v.(type) {
+		case bool:
+			return b, true
+		case string:
+			p, err := strconv.ParseBool(strings.TrimSpace(b))
+			return p, err == nil
+		case []byte:
+			p, err := strconv.ParseBool(strings.TrimSpace(string(b)))
+			return p, err == nil
+		}
+
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, false
+		}
+		return f != 0, true
+	}
+
+	return nil, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	case []byte:
+		return toFloat(string(n))
+	}
+
+	return 0, false
+}
+
+func toString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case time.Time:
+		return s.UTC().Format(time.RFC3339)
+	case primitive.DateTime:
+		return s.Time().UTC().Format(time.RFC3339)
+	case primitive.ObjectID:
+		return s.Hex()
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// encodeID converts _id of mongo document to primary key of meilisearch, object
+// id and uuid are encoded as string and other binary as hex, rest is kept as is.
+func encodeID(v any) any {
+	switch id := v.(type) {
+	case primitive.ObjectID:
+		return id.Hex()
+	case primitive.Binary:
+		if (id.Subtype == bson.TypeBinaryUUID || id.Subtype == bson.TypeBinaryUUIDOld) && len(id.Data) == 16 {
+			d := id.Data
+			return fmt.Sprintf("%x-%x-%x-%x-%x", d[0:4], d[4:6], d[6:8], d[8:10], d[10:16])
+		}
+		return hex.EncodeToString(id.Data)
+	}
+
+	return v
+}
+
+// decodeIDs returns _ids of mongo document which may be encoded to s by encodeID,
+// uuid is returned with both of its subtypes. It's empty if s isn't object id or
+// uuid, s itself may be _id too, so lookups match s and decoded ids.
+func decodeIDs(s string) []any {
+	if oid, err := primitive.ObjectIDFromHex(s); err == nil {
+		return []any{oid}
+	}
+
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil
+	}
+
+	d, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return nil
+	}
+
+	return []any{
+		primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: d},
+		primitive.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: d},
+	}
+}
+
+// toTimestamp converts date to unix timestamp in seconds, numbers are
+// considered as timestamp already.
+func toTimestamp(v any, layout string) (int64, bool) {
+	switch d := v.(type) {
+	case time.Time:
+		return d.Unix(), true
+	case primitive.DateTime:
+		return d.Time().Unix(), true
+	case primitive.Timestamp:
+		return int64(d.T), true
+	case []byte:
+		return toTimestamp(string(d), layout)
+	case string:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+
+		for _, l := range append([]string{layout}, _dateLayouts...) {
+			if t, err := time.Parse(l, d); err == nil {
+				return t.Unix(), true
+			}
+		}
+
+		return 0, false
+	}
+
+	f, ok := toFloat(v)
+	if !ok {
+		return 0, false
+	}
+
+	return int64(f), true
+}
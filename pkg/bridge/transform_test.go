@@ -0,0 +1,200 @@
+package bridge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_TransformDocuments(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		Name       string
+		Document   database.Result
+		Transforms []*config.Transform
+		Excepted   database.Result
+	}{
+		{
+			Name:     "cast",
+			Document: database.Result{"price": "12.5", "qty": "3", "active": "true", "code": int64(7), "bad": "foo"},
+			Transforms: []*config.Transform{
+				{Type: config.CAST, Field: "price", To: "float"},
+				{Type: config.CAST, Field: "qty", To: "int"},
+				{Type: config.CAST, Field: "active", To: "bool"},
+				{Type: config.CAST, Field: "code", To: "string"},
+				{Type: config.CAST, Field: "bad", To: "int"},
+			},
+			Excepted: database.Result{"price": 12.5, "qty": int64(3), "active": true, "code": "7", "bad": "foo"},
+		},
+		{
+			Name:     "timestamp",
+			Document: database.Result{"created_at": created, "updated_at": "2024-01-02 03:04:05", "ts": int64(10)},
+			Transforms: []*config.Transform{
+				{Type: config.TIMESTAMP, Field: "created_at"},
+				{Type: config.TIMESTAMP, Field: "updated_at"},
+				{Type: config.TIMESTAMP, Field: "ts"},
+			},
+			Excepted: database.Result{"created_at": created.Unix(), "updated_at": created.Unix(), "ts": int64(10)},
+		},
+		{
+			Name:     "concat",
+			Document: database.Result{"first": "John", "last": "Doe", "middle": nil},
+			Transforms: []*config.Transform{
+				{Type: config.CONCAT, Field: "full_name", Fields: []string{"first", "middle", "last"}, Separator: " "},
+			},
+			Excepted: database.Result{"first": "John", "last": "Doe", "middle": nil, "full_name": "John Doe"},
+		},
+		{
+			Name:     "default and drop null",
+			Document: database.Result{"status": nil, "note": nil, "tag": nil},
+			Transforms: []*config.Transform{
+				{Type: config.DEFAULT, Field: "status", Value: "active"},
+				{Type: config.DEFAULT, Field: "lang", Value: "en"},
+				{Type: config.DROP_NULL, Field: "note"},
+				{Type: config.DROP_NULL},
+			},
+			Excepted: database.Result{"status": "active", "lang": "en"},
+		},
+		{
+			Name:     "lowercase and trim",
+			Document: database.Result{"email": " Foo@Bar.COM ", "n": 1},
+			Transforms: []*config.Transform{
+				{Type: config.TRIM, Field: "email"},
+				{Type: config.LOWERCASE, Field: "email"},
+				{Type: config.LOWERCASE, Field: "n"},
+			},
+			Excepted: database.Result{"email": "foo@bar.com", "n": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			doc := tt.Document
+			transformDocuments([]*database.Result{&doc}, tt.Transforms)
+			assert.Equal(t, tt.Excepted, doc)
+
+			// applying again doesn't change document
+			transformDocuments([]*database.Result{&doc}, tt.Transforms)
+			assert.Equal(t, tt.Excepted, doc)
+		})
+	}
+}
+
+func Test_MapDocuments(t *testing.T) {
+	des := &config.IndexConfig{
+		Fields: map[string]string{"id": "", "created": "created_at"},
+		Transforms: []*config.Transform{
+			{Type: config.TIMESTAMP, Field: "created_at"},
+		},
+	}
+
+	doc := database.Result{"id": 1, "created": "2024-01-02T03:04:05Z", "secret": "foo"}
+	_, err := mapDocuments(context.Background(), []*database.Result{&doc}, des)
+	require.NoError(t, err)
+
+	assert.Equal(t, database.Result{"id": 1, "created_at": int64(1704164645)}, doc)
+}
+
+func Test_MapDocumentsDiscriminator(t *testing.T) {
+	des := &config.IndexConfig{
+		Fields:        map[string]string{"id": "", "type": ""},
+		Discriminator: &config.Discriminator{Field: "type", Value: "user"},
+	}
+
+	doc := database.Result{"id": 1, "type": "admin"}
+	docs, err := mapDocuments(context.Background(), []*database.Result{&doc}, des)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*database.Result{{"id": 1, "type": "user"}}, docs)
+}
+
+func Test_MapDocumentsSkip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fail.star")
+	require.NoError(t, os.WriteFile(path, []byte(`
+def transform(doc):
+    if doc["id"] == 2:
+        fail("broken")
+    return doc
+`), 0o600))
+
+	des := &config.IndexConfig{PrimaryKey: "id", Script: &config.Script{Path: path}}
+
+	skipped := make([]any, 0)
+	skip := func(doc database.Result, _ error) {
+		skipped = append(skipped, doc["id"])
+	}
+
+	docs, err := mapDocumentsSkip(context.Background(), []*database.Result{{"id": 1}, {"id": 2}, {"id": 3}}, des, skip)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*database.Result{{"id": int64(1)}, {"id": int64(3)}}, docs)
+	assert.Equal(t, []any{2}, skipped)
+
+	// without skip error of script fails all documents
+	_, err = mapDocuments(context.Background(), []*database.Result{{"id": 1}, {"id": 2}}, des)
+	assert.Error(t, err)
+}
+
+func Test_LoadScriptTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noop.star")
+	require.NoError(t, os.WriteFile(path, []byte("def transform(doc):\n    return doc\n"), 0o600))
+
+	s1, err := loadScript(&config.Script{Path: path, Timeout: 10})
+	require.NoError(t, err)
+
+	s2, err := loadScript(&config.Script{Path: path, Timeout: 20})
+	require.NoError(t, err)
+	assert.NotSame(t, s1, s2)
+
+	s3, err := loadScript(&config.Script{Path: path, Timeout: 10})
+	require.NoError(t, err)
+	assert.Same(t, s1, s3)
+}
+
+func Test_EncodeID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	uuid := primitive.Binary{
+		Subtype: bson.TypeBinaryUUID,
+		Data:    []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00},
+	}
+
+	tests := []struct {
+		Name     string
+		ID       any
+		Excepted any
+		Decoded  bool
+	}{
+		{Name: "object id", ID: oid, Excepted: oid.Hex(), Decoded: true},
+		{Name: "uuid", ID: uuid, Excepted: "123e4567-e89b-12d3-a456-426614174000", Decoded: true},
+		{Name: "string", ID: "user-1", Excepted: "user-1"},
+		{Name: "int", ID: int32(42), Excepted: int32(42)},
+		{Name: "binary", ID: primitive.Binary{Data: []byte{0xca, 0xfe}}, Excepted: "cafe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			doc := database.Result{"_id": tt.ID}
+			docs, err := mapDocuments(context.Background(), []*database.Result{&doc}, &config.IndexConfig{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, (*docs[0])["_id"])
+
+			if s, ok := tt.Excepted.(string); ok {
+				ids := decodeIDs(s)
+				assert.Equal(t, tt.Decoded, len(ids) > 0)
+				if tt.Decoded {
+					assert.Contains(t, ids, tt.ID)
+				}
+			}
+		})
+	}
+}
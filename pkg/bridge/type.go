@@ -4,18 +4,23 @@ import (
 	"context"
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/Ja7ad/meilibridge/pkg/store"
 	"net/http"
+	"time"
 )
 
 const (
 	_bulkLimit        = int64(100)
 	_triggerHeaderKey = "x-token-key"
+	_defaultWorkers   = 4
 )
 
 type Bridge struct {
 	bridges    []*config.Bridge
 	mux        *http.ServeMux
 	triggerCfg *config.TriggerSync
+	engines    []string
+	stores     map[string]store.Store
 	log        logger.Logger
 }
 
@@ -30,9 +35,33 @@ type task struct {
 	des *config.IndexConfig
 }
 
+// BulkOptions controls how bulk sync writes to index.
+type BulkOptions struct {
+	// Continue syncs data on existing index instead of recreating it.
+	Continue bool
+	// Swap fills a temporary index and swaps it with live index, so search
+	// keeps working during full bulk sync.
+	Swap bool
+}
+
+// SyncOptions controls how real-time sync starts.
+type SyncOptions struct {
+	// Snapshot loads indexes with bulk sync before streaming changes, changes
+	// made during bulk are applied after it.
+	Snapshot bool
+	// Workers is number of ordered workers of change stream of every index,
+	// events of same document are applied in order by one worker.
+	Workers int
+	// Coalesce is window which events of same document are merged in, zero
+	// applies every event.
+	Coalesce time.Duration
+}
+
 type Syncer interface {
 	Name() string
-	OnDemand(ctx context.Context)
-	Bulk(ctx context.Context, isContinue bool)
+	OnDemand(ctx context.Context, opts SyncOptions)
+	Bulk(ctx context.Context, opts BulkOptions)
+	Reconcile(ctx context.Context, dryRun bool) error
 	Trigger() http.HandlerFunc
+	BatchTrigger() http.HandlerFunc
 }
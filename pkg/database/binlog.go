@@ -0,0 +1,435 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"gorm.io/gorm"
+)
+
+const (
+	_binlogRetryWait = 5 * time.Second
+	// _binlogCheckpointKey is key of confirmed binlog position in checkpoint.
+	_binlogCheckpointKey = "binlog"
+)
+
+type binlogColumn struct {
+	Name     string
+	Type     string
+	Unsigned bool
+}
+
+// binlogStreamer reads row events from mysql binlog as replica and dispatches
+// them to table watchers. Position after applied transactions is saved in
+// checkpoint, so stream resumes from it after restart.
+type binlogStreamer struct {
+	src      *config.Database
+	db       *gorm.DB
+	log      logger.Logger
+	watchers *tableWatchers
+	cp       Checkpoint
+
+	// pos is position after last transaction read from stream
+	pos     mysql.Position
+	columns map[string][]binlogColumn
+}
+
+func newBinlogStreamer(src *config.Database, db *gorm.DB, log logger.Logger) *binlogStreamer {
+	b := &binlogStreamer{
+		src:     src,
+		db:      db,
+		log:     log,
+		columns: make(map[string][]binlogColumn),
+	}
+
+	b.watchers = newTableWatchers(func(pos []byte) {
+		if b.cp != nil {
+			b.cp.Save(_binlogCheckpointKey, pos)
+		}
+	})
+
+	return b
+}
+
+func (b *binlogStreamer) Subscribe(ctx context.Context, table string, cp Checkpoint) (<-chan func() (WatcherType, WatchResult), error) {
+	return b.watchers.subscribe(ctx, table, func() error {
+		b.cp = cp
+		if err := b.prepare(ctx); err != nil {
+			return err
+		}
+		go b.run(ctx)
+		return nil
+	})
+}
+
+// prepare checks server binlog configuration and loads start position, saved
+// position of checkpoint has priority over current position of server.
+func (b *binlogStreamer) prepare(ctx context.Context) error {
+	db := b.db.WithContext(ctx)
+
+	var format string
+	if err := db.Raw("SELECT @@global.binlog_format").Row().Scan(&format); err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(format, "ROW") {
+		return fmt.Errorf("binlog_format must be ROW for real-time sync, current is %s", format)
+	}
+
+	if b.cp != nil {
+		if saved := b.cp.Load(_binlogCheckpointKey); saved != nil {
+			pos, err := parseBinlogPosition(saved)
+			if err != nil {
+				return err
+			}
+			b.pos = pos
+			return nil
+		}
+	}
+
+	rows, err := db.Raw("SHOW MASTER STATUS").Rows()
+	if err != nil {
+		rows, err = db.Raw("SHOW BINARY LOG STATUS").Rows()
+		if err != nil {
+			return err
+		}
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return errors.New("binary logging is not enabled on mysql server")
+	}
+
+	data, err := decodeRows(rows)
+	if err != nil {
+		return err
+	}
+
+	pos, err := strconv.ParseUint(fmt.Sprintf("%s", data["Position"]), 10, 32)
+	if err != nil {
+		return err
+	}
+	b.pos = mysql.Position{Name: fmt.Sprintf("%s", data["File"]), Pos: uint32(pos)}
+
+	return nil
+}
+
+func (b *binlogStreamer) run(ctx context.Context) {
+	defer b.watchers.close()
+
+	ctx, cancel := b.watchers.context(ctx)
+	defer cancel()
+
+	for {
+		err := b.stream(ctx)
+		if err := b.watchers.err(); err != nil {
+			b.log.Error("binlog stream stopped, change isn't written to index",
+				"file", b.pos.Name, "pos", b.pos.Pos, "err", err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		b.log.Error("binlog stream interrupted, trying to reconnect...",
+			"file", b.pos.Name, "pos", b.pos.Pos, "err", err)
+
+		t := time.NewTimer(_binlogRetryWait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (b *binlogStreamer) stream(ctx context.Context) error {
+	syncer := replication.NewBinlogSyncer(b.syncerConfig())
+	defer syncer.Close()
+
+	// stream restarts from last complete transaction, rows of interrupted
+	// transaction are dispatched again which is harmless as rows are read back
+	streamer, err := syncer.StartSync(b.pos)
+	if err != nil {
+		return err
+	}
+
+	b.log.Info("started mysql binlog stream", "file", b.pos.Name, "pos", b.pos.Pos)
+
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return err
+		}
+
+		// failed event stops stream before its transaction is committed, so
+		// position isn't confirmed past it and stream restarts from last
+		// committed transaction
+		if err := b.handleEvent(ctx, ev); err != nil {
+			return fmt.Errorf("failed to handle binlog event: %w", err)
+		}
+	}
+}
+
+func (b *binlogStreamer) syncerConfig() replication.BinlogSyncerConfig {
+	cfg := replication.BinlogSyncerConfig{
+		ServerID:         b.src.Replication.ServerID,
+		Flavor:           mysql.MySQLFlavor,
+		Host:             b.src.Host,
+		Port:             b.src.Port,
+		User:             b.src.User,
+		Password:         b.src.Password,
+		ParseTime:        true,
+		DisableRetrySync: true,
+		// errors of stream are returned by GetEvent and logged by streamer
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	// tls of binlog connection follows tls param of mysql dsn
+	switch fmt.Sprintf("%v", b.src.CustomParams["tls"]) {
+	case "true":
+		cfg.TLSConfig = &tls.Config{ServerName: b.src.Host}
+	case "skip-verify", "preferred":
+		cfg.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return cfg
+}
+
+func (b *binlogStreamer) handleEvent(ctx context.Context, ev *replication.BinlogEvent) error {
+	switch e := ev.Event.(type) {
+	case *replication.RotateEvent:
+		b.pos = mysql.Position{Name: string(e.NextLogName), Pos: uint32(e.Position)}
+		b.watchers.commit(formatBinlogPosition(b.pos))
+	case *replication.XIDEvent:
+		b.commit(ev.Header)
+	case *replication.QueryEvent:
+		// statements other than begin end transaction of non-transactional
+		// tables or are ddl, both are safe to resume after
+		if !strings.EqualFold(string(e.Query), "BEGIN") {
+			b.commit(ev.Header)
+		}
+	case *replication.RowsEvent:
+		return b.handleRows(ctx, ev.Header.EventType, e)
+	}
+
+	return nil
+}
+
+func (b *binlogStreamer) commit(h *replication.EventHeader) {
+	if h.LogPos == 0 {
+		return
+	}
+
+	b.pos.Pos = h.LogPos
+	b.watchers.commit(formatBinlogPosition(b.pos))
+}
+
+func (b *binlogStreamer) handleRows(ctx context.Context, typ replication.EventType, e *replication.RowsEvent) error {
+	schema, table := string(e.Table.Schema), string(e.Table.Table)
+	if schema != b.src.Database || !b.watchers.has(table) {
+		return nil
+	}
+
+	columns, err := b.loadColumns(ctx, schema, table, int(e.ColumnCount))
+	if err != nil {
+		return err
+	}
+
+	for _, change := range binlogChanges(typ, e, columns) {
+		b.watchers.dispatch(ctx, table, change.wType, change.res)
+	}
+
+	return nil
+}
+
+type binlogChange struct {
+	wType WatcherType
+	res   WatchResult
+}
+
+// binlogChanges converts rows of event to changes. Update carries before image,
+// so its document has key columns which minimal row image leaves out of after
+// image and watcher can remove document of changed key.
+func binlogChanges(typ replication.EventType, e *replication.RowsEvent, columns []binlogColumn) []binlogChange {
+	image := func(i int) Result {
+		var skipped []int
+		if i < len(e.SkippedColumns) {
+			skipped = e.SkippedColumns[i]
+		}
+		return rowToResult(e.Rows[i], skipped, columns)
+	}
+
+	var changes []binlogChange
+
+	switch typ {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2,
+		replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		for i := range e.Rows {
+			changes = append(changes, binlogChange{wType: OnInsert, res: WatchResult{Document: image(i)}})
+		}
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2,
+		replication.MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		for i := range e.Rows {
+			changes = append(changes, binlogChange{wType: OnDelete, res: WatchResult{Document: image(i)}})
+		}
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2,
+		replication.PARTIAL_UPDATE_ROWS_EVENT, replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		// rows of update are pairs of before and after images
+		for i := 0; i+1 < len(e.Rows); i += 2 {
+			before, after := image(i), image(i+1)
+
+			doc := make(Result, len(before)+len(after))
+			for k, v := range before {
+				doc[k] = v
+			}
+			for k, v := range after {
+				doc[k] = v
+			}
+
+			changes = append(changes, binlogChange{wType: OnUpdate, res: WatchResult{Document: doc, Before: before}})
+		}
+	}
+
+	return changes
+}
+
+// loadColumns loads columns of table, table map event doesn't carry names of
+// columns unless binlog_row_metadata is FULL. Columns are reloaded when count
+// of columns changes.
+func (b *binlogStreamer) loadColumns(ctx context.Context, schema, table string, count int) ([]binlogColumn, error) {
+	key := schema + "." + table
+
+	if columns, ok := b.columns[key]; ok && len(columns) == count {
+		return columns, nil
+	}
+
+	rows, err := b.db.WithContext(ctx).Raw(
+		"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS "+
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		schema, table,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]binlogColumn, 0, count)
+	for rows.Next() {
+		var name, dataType, columnType string
+		if err := rows.Scan(&name, &dataType, &columnType); err != nil {
+			return nil, err
+		}
+		columns = append(columns, binlogColumn{
+			Name:     name,
+			Type:     strings.ToLower(dataType),
+			Unsigned: strings.Contains(strings.ToLower(columnType), "unsigned"),
+		})
+	}
+
+	if len(columns) != count {
+		return nil, fmt.Errorf("columns of table %s don't match with binlog", key)
+	}
+
+	b.columns[key] = columns
+
+	return columns, nil
+}
+
+// rowToResult maps values of row image to names of columns, columns which
+// aren't in image are left out.
+func rowToResult(row []any, skipped []int, columns []binlogColumn) Result {
+	skip := make(map[int]bool, len(skipped))
+	for _, i := range skipped {
+		skip[i] = true
+	}
+
+	res := make(Result, len(row))
+	for i, v := range row {
+		if i >= len(columns) || skip[i] {
+			continue
+		}
+		res[columns[i].Name] = columnValue(columns[i], v)
+	}
+
+	return mapToResult(res)
+}
+
+// columnValue converts value of binlog to value of column type, binlog keeps
+// unsigned integers as signed and json as text.
+func columnValue(col binlogColumn, v any) any {
+	if col.Type == "json" {
+		var data []byte
+		switch d := v.(type) {
+		case []byte:
+			data = d
+		case string:
+			data = []byte(d)
+		default:
+			// partial json update has only diff of document
+			return nil
+		}
+
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return string(data)
+		}
+		return doc
+	}
+
+	if !col.Unsigned {
+		return v
+	}
+
+	switch n := v.(type) {
+	case int8:
+		return uint8(n)
+	case int16:
+		return uint16(n)
+	case int32:
+		if col.Type == "mediumint" {
+			return uint32(n) & 0xffffff
+		}
+		return uint32(n)
+	case int64:
+		return uint64(n)
+	}
+
+	return v
+}
+
+func formatBinlogPosition(pos mysql.Position) []byte {
+	return []byte(fmt.Sprintf("%s:%d", pos.Name, pos.Pos))
+}
+
+func parseBinlogPosition(data []byte) (mysql.Position, error) {
+	s := string(data)
+
+	i := strings.LastIndex(s, ":")
+	if i < 1 {
+		return mysql.Position{}, fmt.Errorf("invalid binlog position %q", s)
+	}
+
+	pos, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("invalid binlog position %q: %w", s, err)
+	}
+
+	return mysql.Position{Name: s[:i], Pos: uint32(pos)}, nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BinlogChanges(t *testing.T) {
+	columns := []binlogColumn{
+		{Name: "id", Type: "int"},
+		{Name: "name", Type: "varchar"},
+		{Name: "meta", Type: "json"},
+	}
+
+	tests := []struct {
+		Name     string
+		Type     replication.EventType
+		Event    *replication.RowsEvent
+		Excepted []binlogChange
+	}{
+		{
+			Name: "insert",
+			Type: replication.WRITE_ROWS_EVENTv2,
+			Event: &replication.RowsEvent{
+				Rows: [][]any{{int32(1), "foo", []byte(`{"a":1}`)}},
+			},
+			Excepted: []binlogChange{
+				{wType: OnInsert, res: WatchResult{Document: Result{
+					"id": int32(1), "name": "foo", "meta": map[string]any{"a": float64(1)},
+				}}},
+			},
+		},
+		{
+			Name: "update with changed key",
+			Type: replication.UPDATE_ROWS_EVENTv2,
+			Event: &replication.RowsEvent{
+				Rows: [][]any{
+					{int32(1), "foo", nil},
+					{int32(2), "bar", nil},
+				},
+			},
+			Excepted: []binlogChange{
+				{wType: OnUpdate, res: WatchResult{
+					Document: Result{"id": int32(2), "name": "bar", "meta": nil},
+					Before:   Result{"id": int32(1), "name": "foo", "meta": nil},
+				}},
+			},
+		},
+		{
+			Name: "update with minimal row image",
+			Type: replication.UPDATE_ROWS_EVENTv2,
+			Event: &replication.RowsEvent{
+				Rows: [][]any{
+					{int32(1), nil, nil},
+					{nil, "bar", nil},
+				},
+				SkippedColumns: [][]int{{1, 2}, {0, 2}},
+			},
+			Excepted: []binlogChange{
+				{wType: OnUpdate, res: WatchResult{
+					Document: Result{"id": int32(1), "name": "bar"},
+					Before:   Result{"id": int32(1)},
+				}},
+			},
+		},
+		{
+			Name: "delete",
+			Type: replication.DELETE_ROWS_EVENTv2,
+			Event: &replication.RowsEvent{
+				Rows:           [][]any{{int32(3), nil, nil}},
+				SkippedColumns: [][]int{{1, 2}},
+			},
+			Excepted: []binlogChange{
+				{wType: OnDelete, res: WatchResult{Document: Result{"id": int32(3)}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, binlogChanges(tt.Type, tt.Event, columns))
+		})
+	}
+}
+
+func Test_ColumnValue(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Column   binlogColumn
+		Value    any
+		Excepted any
+	}{
+		{
+			Name:     "json",
+			Column:   binlogColumn{Type: "json"},
+			Value:    []byte(`{"tags":["a"]}`),
+			Excepted: map[string]any{"tags": []any{"a"}},
+		},
+		{
+			Name:     "unsigned int",
+			Column:   binlogColumn{Type: "int", Unsigned: true},
+			Value:    int32(-1),
+			Excepted: uint32(4294967295),
+		},
+		{
+			Name:     "unsigned mediumint",
+			Column:   binlogColumn{Type: "mediumint", Unsigned: true},
+			Value:    int32(-1),
+			Excepted: uint32(16777215),
+		},
+		{
+			Name:     "unsigned bigint",
+			Column:   binlogColumn{Type: "bigint", Unsigned: true},
+			Value:    int64(-1),
+			Excepted: uint64(18446744073709551615),
+		},
+		{
+			Name:     "signed",
+			Column:   binlogColumn{Type: "int"},
+			Value:    int32(-1),
+			Excepted: int32(-1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Excepted, columnValue(tt.Column, tt.Value))
+		})
+	}
+}
+
+func Test_ParseBinlogPosition(t *testing.T) {
+	pos := mysql.Position{Name: "mysql-bin.000042", Pos: 1234}
+
+	got, err := parseBinlogPosition(formatBinlogPosition(pos))
+	require.NoError(t, err)
+	assert.Equal(t, pos, got)
+
+	_, err = parseBinlogPosition([]byte("mysql-bin.000042"))
+	assert.Error(t, err)
+
+	_, err = parseBinlogPosition([]byte("mysql-bin.000042:foo"))
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/Ja7ad/meilibridge/config"
@@ -14,39 +15,49 @@ func init() {
 	_pool = new(sync.Map)
 }
 
+// AddEngine connects to source and registers executor by name, usually the bridge name,
+// so several bridges can use same database engine with different sources.
 func AddEngine(
 	ctx context.Context,
+	name string,
 	source *config.Database,
 	log logger.Logger,
 ) error {
+	if _, exists := _pool.Load(name); exists {
+		return fmt.Errorf("%w: %s", ErrEngineExists, name)
+	}
+
+	var (
+		exec GlobalExecutor
+		err  error
+	)
+
 	switch source.Engine {
 	case config.MONGO:
-		mgoExec, err := newMongo(ctx, source, log)
-		if err != nil {
-			return err
-		}
-		_pool.Store(config.MONGO, mgoExec)
-		return nil
-	case config.MYSQL:
-		sqlExec, err := newSQL(source, log)
-		if err != nil {
-			return err
-		}
-		_pool.Store(config.MYSQL, sqlExec)
-		return nil
-	case config.POSTGRES:
-		sqlExec, err := newSQL(source, log)
-		if err != nil {
-			return err
-		}
-		_pool.Store(config.POSTGRES, sqlExec)
-		return nil
+		exec, err = newMongo(ctx, source, log)
+	case config.MYSQL, config.POSTGRES:
+		exec, err = newSQL(source, log)
 	default:
 		return ErrEngineNotSupported
 	}
+	if err != nil {
+		return err
+	}
+
+	_pool.Store(name, exec)
+	return nil
 }
 
-func GetEngine[T GlobalExecutor](engine config.Engine) T {
-	eng, _ := _pool.Load(engine)
+func GetEngine[T GlobalExecutor](name string) T {
+	eng, _ := _pool.Load(name)
 	return eng.(T)
 }
+
+// RemoveEngine closes executor of name and removes it from pool.
+func RemoveEngine(name string) error {
+	eng, exists := _pool.LoadAndDelete(name)
+	if !exists {
+		return nil
+	}
+	return eng.(GlobalExecutor).Close()
+}
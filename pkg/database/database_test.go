@@ -11,13 +11,15 @@ import (
 )
 
 func Test_Engine(t *testing.T) {
-	err := AddEngine(context.Background(), &config.Database{
+	err := AddEngine(context.Background(), "bridge1", &config.Database{
 		Engine:   config.MONGO,
 		Host:     os.Getenv("MONGO_HOST"),
 		Database: os.Getenv("MONGO_DATABASE"),
 	}, logger.DefaultLogger)
 	require.Nil(t, err)
 
-	mgoEngine := GetEngine[MongoExecutor](config.MONGO)
+	mgoEngine := GetEngine[MongoExecutor]("bridge1")
 	require.NotNil(t, mgoEngine)
+
+	require.NoError(t, RemoveEngine("bridge1"))
 }
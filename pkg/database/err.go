@@ -2,4 +2,12 @@ package database
 
 import "errors"
 
-var ErrEngineNotSupported = errors.New("database not engine supported")
+var (
+	ErrEngineNotSupported   = errors.New("database not engine supported")
+	ErrRealtimeNotSupported = errors.New("real-time sync is not supported for database engine")
+	ErrResumeTokenLost      = errors.New("change stream resume token is no longer in oplog")
+	ErrEngineExists         = errors.New("database engine already exists")
+	ErrCursorKeyRequire     = errors.New("cursor key is required for pagination")
+	ErrCursorKeyNotFound    = errors.New("cursor key not found in result")
+	ErrNoOperationTime      = errors.New("operation time is not available, mongo must be replica set")
+)
@@ -77,12 +77,23 @@ func dsnMaker(src *config.Database) string {
 	return dsn.String()
 }
 
-func buildQueryFindOne(table string, query map[string]interface{}) (string, []interface{}) {
+func buildQueryFindOne(table string, query map[string]interface{}, filter *Filter) (string, []interface{}) {
 	whereClause, args := buildWhereClause(query)
+	if filter != nil && filter.Query != "" {
+		whereClause += fmt.Sprintf(" AND (%s)", filter.Query)
+		args = append(args, filter.Args...)
+	}
 	queryStr := fmt.Sprintf("SELECT * FROM %s WHERE %s LIMIT 1", table, whereClause)
 	return queryStr, args
 }
 
+// Subquery returns SELECT query as derived table, so it can be used in place of
+// table name.
+func Subquery(query string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("(%s) AS %s", query, _subqueryAlias)
+}
+
 func buildWhereClause(query map[string]interface{}) (string, []interface{}) {
 	whereClause := ""
 	args := make([]interface{}, 0, len(query))
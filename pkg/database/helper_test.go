@@ -6,6 +6,10 @@ import (
 
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func Test_DSNMaker(t *testing.T) {
@@ -154,3 +158,82 @@ func TestParseSQLTime(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildQueryFindOne(t *testing.T) {
+	query, args := buildQueryFindOne("users", map[string]interface{}{"id": 1},
+		&Filter{Query: "is_active = ? OR age > ?", Args: []any{true, 18}})
+
+	assert.Equal(t, "SELECT * FROM users WHERE id = ? AND (is_active = ? OR age > ?) LIMIT 1", query)
+	assert.Equal(t, []interface{}{1, true, 18}, args)
+}
+
+func TestPrefixFilter(t *testing.T) {
+	filter := bson.D{
+		{Key: "status", Value: "active"},
+		{Key: "$or", Value: bson.A{
+			map[string]any{"age": bson.D{{Key: "$gt", Value: 18}}},
+			bson.M{"vip": true},
+		}},
+	}
+
+	assert.Equal(t, bson.D{
+		{Key: "fullDocument.status", Value: "active"},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "fullDocument.age", Value: bson.D{{Key: "$gt", Value: 18}}}},
+			bson.D{{Key: "fullDocument.vip", Value: true}},
+		}},
+	}, prefixFilter(filter, "fullDocument."))
+}
+
+func TestBuildChangeStreamAggregationPipeline(t *testing.T) {
+	pipeline := buildChangeStreamAggregationPipeline(nil)
+	require.Len(t, pipeline, 2)
+
+	// pre-image is kept, so Before of result is set
+	assert.Equal(t, bson.D{
+		{Key: "$project", Value: bson.D{
+			{Key: "operationType", Value: 1},
+			{Key: "documentKey", Value: 1},
+			{Key: "fullDocument", Value: 1},
+			{Key: "updateDescription", Value: 1},
+			{Key: "fullDocumentBeforeChange", Value: 1},
+		}},
+	}, pipeline[1])
+}
+
+func TestSubquery(t *testing.T) {
+	table := Subquery(" SELECT u.id, b.title FROM users u JOIN books b ON b.user_id = u.id; ")
+	assert.Equal(t, "(SELECT u.id, b.title FROM users u JOIN books b ON b.user_id = u.id) AS _source", table)
+
+	query, args := buildQueryFindOne(table, map[string]interface{}{"id": 1}, nil)
+	assert.Equal(t, "SELECT * FROM "+table+" WHERE id = ? LIMIT 1", query)
+	assert.Equal(t, []interface{}{1}, args)
+}
+
+func TestKeysetAfter(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name     string
+		Keys     []string
+		Last     []any
+		Excepted string
+	}{
+		{Name: "single", Keys: []string{"id"}, Last: []any{10}, Excepted: `SELECT * FROM "items" WHERE "id" > $1`},
+		{
+			Name:     "composite",
+			Keys:     []string{"tenant_id", "sku"},
+			Last:     []any{7, "ab"},
+			Excepted: `SELECT * FROM "items" WHERE ("tenant_id", "sku") > ($1, $2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			stmt := db.Table("items").Where(keysetAfter(tt.Keys, tt.Last)).Find(&[]Result{}).Statement
+			assert.Equal(t, tt.Excepted, stmt.SQL.String())
+			assert.Equal(t, tt.Last, stmt.Vars)
+		})
+	}
+}
@@ -2,17 +2,25 @@ package database
 
 import (
 	"context"
-	"math"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/Ja7ad/meilibridge/config"
 
 	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	_changeStreamFatalError  = 280
+	_changeStreamHistoryLost = 286
+)
+
 type Mongo struct {
 	cli *mongo.Client
 	log logger.Logger
@@ -62,8 +70,11 @@ func (m *Mongo) AddCollection(col string) {
 	}
 }
 
-func (m *Mongo) Count(ctx context.Context, col string) (int64, error) {
-	return m.collections[col].EstimatedDocumentCount(ctx)
+func (m *Mongo) Count(ctx context.Context, col string, filter any) (int64, error) {
+	if filter == nil {
+		return m.collections[col].EstimatedDocumentCount(ctx)
+	}
+	return m.collections[col].CountDocuments(ctx, filter)
 }
 
 func (m *Mongo) FindOne(ctx context.Context, filter interface{}, col string) (Result, error) {
@@ -72,37 +83,168 @@ func (m *Mongo) FindOne(ctx context.Context, filter interface{}, col string) (Re
 	return res, m.collections[col].FindOne(ctx, filter).Decode(&res)
 }
 
-func (m *Mongo) FindLimit(ctx context.Context, limit int64, col string) (Cursor, error) {
-	count, err := m.Count(ctx, col)
+// FindLimit streams collection ordered by _id from single cursor in batches of limit,
+// if cursor is lost it's reopened after last _id.
+func (m *Mongo) FindLimit(ctx context.Context, limit int64, col string, since *Watermark, filter any) (Cursor, error) {
+	return &mongoCursor{
+		col:    m.collections[col],
+		limit:  limit,
+		since:  since,
+		filter: filter,
+		err:    nil,
+		res:    make([]*Result, 0),
+	}, nil
+}
+
+// Max returns maximum value of field in collection, nil if collection is empty.
+func (m *Mongo) Max(ctx context.Context, col, field string) (any, error) {
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: field, Value: -1}}).
+		SetProjection(bson.D{{Key: field, Value: 1}})
+
+	var res Result
+	err := m.collections[col].FindOne(ctx, bson.D{}, opts).Decode(&res)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return res[field], nil
+}
+
+// FindMany returns documents of collection which field is one of values.
+func (m *Mongo) FindMany(ctx context.Context, col, field string, values []any, filter any) ([]*Result, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	cur, err := m.collections[col].Find(ctx, MatchFilter(bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: values}}}}, filter))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	results := make([]*Result, 0, len(values))
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Aggregate runs pipeline on documents of collection which match query, so
+// pipeline only processes changed documents.
+func (m *Mongo) Aggregate(ctx context.Context, col string, match any, pipeline []any) ([]*Result, error) {
+	stages := append(bson.A{bson.D{{Key: "$match", Value: match}}}, pipeline...)
+
+	cur, err := m.collections[col].Aggregate(ctx, stages)
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close(ctx)
 
-	totalPages := int64(math.Ceil(float64(count) / float64(limit)))
+	results := make([]*Result, 0)
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
 
+	return results, nil
+}
+
+// AggregateLimit streams output of pipeline like FindLimit, documents are matched
+// and sorted by _id before pipeline, so output must keep _id of source document.
+func (m *Mongo) AggregateLimit(ctx context.Context, limit int64, col string, since *Watermark, filter any, pipeline []any) (Cursor, error) {
 	return &mongoCursor{
-		col:   m.collections[col],
-		limit: limit,
-		pages: totalPages,
-		page:  0,
-		total: count,
-		err:   nil,
-		res:   make([]*Result, 0),
+		col:      m.collections[col],
+		limit:    limit,
+		since:    since,
+		filter:   filter,
+		pipeline: pipeline,
+		err:      nil,
+		res:      make([]*Result, 0),
 	}, nil
 }
 
-func (m *Mongo) Watcher(ctx context.Context, col string) (<-chan func() (wType WatcherType, res WatchResult), error) {
+// Exists returns values which exist in field of collection.
+func (m *Mongo) Exists(ctx context.Context, col, field string, values []any, filter any) ([]any, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find().SetProjection(bson.D{{Key: field, Value: 1}})
+
+	cur, err := m.collections[col].Find(ctx, MatchFilter(bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: values}}}}, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	found := make([]any, 0, len(values))
+	for cur.Next(ctx) {
+		var res Result
+		if err := cur.Decode(&res); err != nil {
+			return nil, err
+		}
+		found = append(found, res[field])
+	}
+
+	return found, cur.Err()
+}
+
+// OperationTime returns current operation time of cluster, change stream which
+// starts at it doesn't miss changes made after this call.
+func (m *Mongo) OperationTime(ctx context.Context) (primitive.Timestamp, error) {
+	var res struct {
+		OperationTime primitive.Timestamp `bson:"operationTime"`
+	}
+
+	if err := m.db.RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Decode(&res); err != nil {
+		return primitive.Timestamp{}, err
+	}
+
+	if res.OperationTime.IsZero() {
+		return primitive.Timestamp{}, ErrNoOperationTime
+	}
+
+	return res.OperationTime, nil
+}
+
+func (m *Mongo) Watcher(
+	ctx context.Context,
+	col string,
+	start StreamStart,
+	filter any,
+) (<-chan func() (wType WatcherType, res WatchResult), error) {
 	resCh := make(chan func() (wType WatcherType, res WatchResult))
 
-	cs, err := m.collections[col].Watch(ctx, buildChangeStreamAggregationPipeline())
+	opts := options.ChangeStream()
+	switch {
+	case len(start.ResumeToken) > 0:
+		opts.SetResumeAfter(bson.Raw(start.ResumeToken))
+	case start.OperationTime != nil:
+		opts.SetStartAtOperationTime(start.OperationTime)
+	}
+
+	if start.PreImage {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+
+	cs, err := m.collections[col].Watch(ctx, buildChangeStreamAggregationPipeline(filter), opts)
 	if err != nil {
+		if isResumeTokenLost(err) {
+			return nil, fmt.Errorf("%w: %s", ErrResumeTokenLost, err.Error())
+		}
 		return nil, err
 	}
 
 	go func() {
+		defer close(resCh)
+		defer cs.Close(context.Background())
+
 		for cs.Next(ctx) {
 			var changeEvent mongoChangeEvent
-
 			err := cs.Decode(&changeEvent)
 			if err != nil {
 				m.log.Error("failed to decode event", "err", err)
@@ -110,8 +252,10 @@ func (m *Mongo) Watcher(ctx context.Context, col string) (<-chan func() (wType W
 			}
 
 			res := WatchResult{
-				DocumentId: changeEvent.DocumentKey,
-				Document:   changeEvent.FullDocument,
+				DocumentId:  changeEvent.DocumentKey,
+				Document:    changeEvent.FullDocument,
+				Before:      changeEvent.FullDocumentBeforeChange,
+				ResumeToken: append([]byte(nil), cs.ResumeToken()...),
 				Update: struct {
 					UpdateFields Result
 					RemoveFields []string
@@ -121,10 +265,18 @@ func (m *Mongo) Watcher(ctx context.Context, col string) (<-chan func() (wType W
 				},
 			}
 
-			resCh <- func() (WatcherType, WatchResult) {
+			select {
+			case <-ctx.Done():
+				return
+			case resCh <- func() (WatcherType, WatchResult) {
 				return m.wType(changeEvent.OperationType), res
+			}:
 			}
 		}
+
+		if err := cs.Err(); err != nil && ctx.Err() == nil {
+			m.log.Error("change stream closed", "collection", col, "err", err)
+		}
 	}()
 
 	return resCh, nil
@@ -146,49 +298,131 @@ func (m *Mongo) wType(op string) WatcherType {
 }
 
 type mongoCursor struct {
-	total  int64
-	pages  int64
-	page   int64
-	limit  int64
-	col    *mongo.Collection
-	cursor *mongo.Cursor
-	err    error
-	res    []*Result
+	limit    int64
+	col      *mongo.Collection
+	cursor   *mongo.Cursor
+	since    *Watermark
+	filter   any
+	pipeline []any
+	last     any
+	done     bool
+	err      error
+	res      []*Result
 }
 
 func (c *mongoCursor) Next(ctx context.Context) bool {
-	if c.page >= c.pages {
+	if c.done {
 		return false
 	}
 
-	skip := c.page * c.limit
-	opts := options.Find().SetLimit(c.limit).SetSkip(skip)
+	c.res = make([]*Result, 0, c.limit)
+
+	reopened := false
+	for int64(len(c.res)) < c.limit {
+		if c.cursor == nil {
+			if c.err = c.open(ctx); c.err != nil {
+				return false
+			}
+		}
+
+		if c.cursor.Next(ctx) {
+			var res Result
+			if c.err = c.cursor.Decode(&res); c.err != nil {
+				return false
+			}
+			c.last = res["_id"]
+			c.res = append(c.res, &res)
+			continue
+		}
 
-	if c.cursor != nil {
-		c.err = c.cursor.Close(ctx)
+		err := c.cursor.Err()
+		_ = c.cursor.Close(ctx)
+		c.cursor = nil
+
+		if err == nil {
+			c.done = true
+			break
+		}
+
+		if reopened || ctx.Err() != nil {
+			c.err = err
+			return false
+		}
+		reopened = true
 	}
 
-	c.cursor, c.err = c.col.Find(ctx, bson.D{}, opts)
-	if c.err != nil {
-		return false
+	return len(c.res) > 0
+}
+
+func (c *mongoCursor) open(ctx context.Context) error {
+	filter := bson.D{}
+	if c.since != nil && c.since.Value != nil {
+		filter = append(filter, bson.E{Key: c.since.Column, Value: bson.D{{Key: "$gte", Value: c.since.Value}}})
+	}
+	if c.last != nil {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: c.last}}})
 	}
 
-	c.res = make([]*Result, 0)
+	if c.pipeline != nil {
+		stages := append(bson.A{
+			bson.D{{Key: "$match", Value: MatchFilter(filter, c.filter)}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}, c.pipeline...)
 
-	if c.err = c.cursor.All(ctx, &c.res); c.err != nil {
-		return false
+		cursor, err := c.col.Aggregate(ctx, stages, options.Aggregate().SetBatchSize(int32(c.limit)))
+		if err != nil {
+			return err
+		}
+		c.cursor = cursor
+
+		return nil
 	}
 
-	c.page++
-	return true
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetBatchSize(int32(c.limit))
+
+	cursor, err := c.col.Find(ctx, MatchFilter(filter, c.filter), opts)
+	if err != nil {
+		return err
+	}
+	c.cursor = cursor
+
+	return nil
 }
 
 func (c *mongoCursor) Result() ([]*Result, error) {
 	return c.res, c.err
 }
 
-func buildChangeStreamAggregationPipeline() mongo.Pipeline {
-	pipeline := mongo.Pipeline{
+// isResumeTokenLost reports whether change stream can't resume because resume
+// token is no longer in oplog.
+func isResumeTokenLost(err error) bool {
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		return se.HasErrorCode(_changeStreamHistoryLost) || se.HasErrorCode(_changeStreamFatalError)
+	}
+	return false
+}
+
+// buildChangeStreamAggregationPipeline builds pipeline of change stream, inserts
+// which don't match filter are dropped. Other events pass, because updated document
+// which no longer matches filter must be removed from index.
+func buildChangeStreamAggregationPipeline(filter any) mongo.Pipeline {
+	pipeline := mongo.Pipeline{}
+
+	if filter != nil {
+		pipeline = append(pipeline, bson.D{
+			{Key: "$match", Value: bson.D{
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "operationType", Value: bson.D{{Key: "$ne", Value: OnInsert.String()}}}},
+					prefixFilter(filter, "fullDocument."),
+				}},
+			}},
+		})
+	}
+
+	pipeline = append(pipeline,
 		bson.D{
 			{
 				Key: "$addFields", Value: bson.D{
@@ -202,9 +436,62 @@ func buildChangeStreamAggregationPipeline() mongo.Pipeline {
 				{Key: "documentKey", Value: 1},
 				{Key: "fullDocument", Value: 1},
 				{Key: "updateDescription", Value: 1},
+				{Key: "fullDocumentBeforeChange", Value: 1},
 			}},
 		},
-	}
+	)
 
 	return pipeline
 }
+
+// MatchFilter joins query with filter, query is returned as is if filter is nil.
+func MatchFilter(query, filter any) any {
+	if filter == nil {
+		return query
+	}
+
+	return bson.D{{Key: "$and", Value: bson.A{query, filter}}}
+}
+
+// prefixFilter prefixes field names of filter, so filter of document matches
+// its sub document like fullDocument of change event.
+func prefixFilter(filter any, prefix string) any {
+	switch f := filter.(type) {
+	case bson.D:
+		res := make(bson.D, 0, len(f))
+		for _, e := range f {
+			res = append(res, prefixFilterElem(e.Key, e.Value, prefix))
+		}
+		return res
+	case map[string]any:
+		res := make(bson.D, 0, len(f))
+		for k, v := range f {
+			res = append(res, prefixFilterElem(k, v, prefix))
+		}
+		return res
+	case bson.M:
+		return prefixFilter(map[string]any(f), prefix)
+	}
+
+	return filter
+}
+
+func prefixFilterElem(key string, value any, prefix string) bson.E {
+	if !strings.HasPrefix(key, "$") {
+		return bson.E{Key: prefix + key, Value: value}
+	}
+
+	// logical operators ($and, $or, $nor) have list of filters
+	switch v := value.(type) {
+	case []any:
+		res := make(bson.A, 0, len(v))
+		for _, f := range v {
+			res = append(res, prefixFilter(f, prefix))
+		}
+		return bson.E{Key: key, Value: res}
+	case bson.A:
+		return prefixFilterElem(key, []any(v), prefix)
+	}
+
+	return bson.E{Key: key, Value: value}
+}
@@ -0,0 +1,603 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"gorm.io/gorm"
+)
+
+const (
+	_standbyStatusInterval = 10 * time.Second
+	_pgRetryWait           = 5 * time.Second
+)
+
+const (
+	_pgKeepaliveMessage     = 'k'
+	_pgXLogDataMessage      = 'w'
+	_pgStandbyStatusMessage = 'r'
+)
+
+const (
+	_pgBoolOID        = 16
+	_pgInt8OID        = 20
+	_pgInt2OID        = 21
+	_pgInt4OID        = 23
+	_pgFloat4OID      = 700
+	_pgFloat8OID      = 701
+	_pgDateOID        = 1082
+	_pgTimestampOID   = 1114
+	_pgTimestampTzOID = 1184
+)
+
+// postgres epoch is 2000-01-01 00:00:00 UTC
+var _pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var errMalformedEvent = errors.New("malformed replication message")
+
+type pgRelation struct {
+	ID        uint32
+	Namespace string
+	Name      string
+	Columns   []pgColumn
+}
+
+type pgColumn struct {
+	Name    string
+	TypeOID uint32
+}
+
+type pgChange struct {
+	RelationID uint32
+	Type       WatcherType
+	// Tuple is new tuple for insert and update, for delete is old key tuple.
+	Tuple []*pgTupleColumn
+	// OldTuple is old key or row of update, it's set when key is changed or
+	// replica identity is full.
+	OldTuple []*pgTupleColumn
+}
+
+type pgTupleColumn struct {
+	Kind byte
+	Data []byte
+}
+
+// pgoutputMessage is decoded logical replication message of pgoutput plugin.
+type pgoutputMessage struct {
+	Type     byte
+	Relation *pgRelation
+	Change   *pgChange
+	// EndLSN is end of commit record for commit message.
+	EndLSN uint64
+}
+
+func parsePgoutputMessage(data []byte) (*pgoutputMessage, error) {
+	if len(data) == 0 {
+		return nil, errMalformedEvent
+	}
+
+	msg := &pgoutputMessage{Type: data[0]}
+	r := &packetReader{buf: data[1:]}
+
+	switch msg.Type {
+	case 'R':
+		rel := new(pgRelation)
+		rel.ID = uint32(r.uintBE(4))
+		rel.Namespace = r.cstring()
+		rel.Name = r.cstring()
+		r.skip(1)
+
+		count := int(r.uintBE(2))
+		rel.Columns = make([]pgColumn, count)
+		for i := 0; i < count; i++ {
+			r.skip(1)
+			rel.Columns[i].Name = r.cstring()
+			rel.Columns[i].TypeOID = uint32(r.uintBE(4))
+			r.skip(4)
+		}
+		msg.Relation = rel
+	case 'I':
+		change := &pgChange{Type: OnInsert}
+		change.RelationID = uint32(r.uintBE(4))
+		r.skip(1)
+		change.Tuple = r.tuple()
+		msg.Change = change
+	case 'U':
+		change := &pgChange{Type: OnUpdate}
+		change.RelationID = uint32(r.uintBE(4))
+		kind := r.uint(1)
+		if kind == 'K' || kind == 'O' {
+			change.OldTuple = r.tuple()
+			r.skip(1)
+		}
+		change.Tuple = r.tuple()
+		msg.Change = change
+	case 'D':
+		change := &pgChange{Type: OnDelete}
+		change.RelationID = uint32(r.uintBE(4))
+		r.skip(1)
+		change.Tuple = r.tuple()
+		msg.Change = change
+	case 'C':
+		r.skip(1)
+		r.skip(8)
+		msg.EndLSN = r.uintBE(8)
+	}
+
+	return msg, r.err
+}
+
+// packetReader reads fields of replication protocol messages.
+type packetReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *packetReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *packetReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.err = errMalformedEvent
+		return nil
+	}
+
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *packetReader) uint(n int) uint64 {
+	b := r.bytes(n)
+	v := uint64(0)
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func (r *packetReader) uintBE(n int) uint64 {
+	b := r.bytes(n)
+	v := uint64(0)
+	for i := range b {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func (r *packetReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+
+	for i := r.pos; i < len(r.buf); i++ {
+		if r.buf[i] == 0 {
+			s := string(r.buf[r.pos:i])
+			r.pos = i + 1
+			return s
+		}
+	}
+
+	r.err = errMalformedEvent
+	return ""
+}
+
+func (r *packetReader) tuple() []*pgTupleColumn {
+	count := int(r.uintBE(2))
+	if r.err != nil {
+		return nil
+	}
+
+	cols := make([]*pgTupleColumn, count)
+	for i := 0; i < count; i++ {
+		col := &pgTupleColumn{Kind: byte(r.uint(1))}
+		switch col.Kind {
+		case 't', 'b':
+			length := int(r.uintBE(4))
+			col.Data = r.bytes(length)
+		}
+		cols[i] = col
+	}
+
+	return cols
+}
+
+// decodePgText converts text representation of column to go value.
+func decodePgText(typeOID uint32, data []byte) any {
+	s := string(data)
+
+	switch typeOID {
+	case _pgBoolOID:
+		return s == "t"
+	case _pgInt2OID, _pgInt4OID, _pgInt8OID:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case _pgFloat4OID, _pgFloat8OID:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case _pgDateOID, _pgTimestampOID, _pgTimestampTzOID:
+		if v, err := parseSQLTime(s); err == nil {
+			return v
+		}
+		if v, err := time.Parse("2006-01-02 15:04:05.999999Z07", s); err == nil {
+			return v
+		}
+	}
+
+	return s
+}
+
+func relationToResult(rel *pgRelation, tuple []*pgTupleColumn) Result {
+	res := make(Result, len(tuple))
+	for i, col := range tuple {
+		if i >= len(rel.Columns) {
+			break
+		}
+
+		switch col.Kind {
+		case 'n':
+			res[rel.Columns[i].Name] = nil
+		case 't':
+			res[rel.Columns[i].Name] = decodePgText(rel.Columns[i].TypeOID, col.Data)
+		}
+	}
+	return res
+}
+
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// pgoutputStreamer consumes postgres logical replication slot with pgoutput plugin
+// and dispatches row changes to table watchers.
+type pgoutputStreamer struct {
+	src         *config.Database
+	db          *gorm.DB
+	log         logger.Logger
+	slot        string
+	publication string
+	watchers    *tableWatchers
+
+	// pubMu serializes preparing publication between watchers
+	pubMu     sync.Mutex
+	relations map[uint32]*pgRelation
+	// inTx is set between begin and commit messages of transaction
+	inTx bool
+	// flushLSN is end of last transaction which changes are applied
+	flushLSN atomic.Uint64
+}
+
+func newPgoutputStreamer(src *config.Database, db *gorm.DB, log logger.Logger) *pgoutputStreamer {
+	p := &pgoutputStreamer{
+		src:       src,
+		db:        db,
+		log:       log,
+		relations: make(map[uint32]*pgRelation),
+	}
+
+	p.watchers = newTableWatchers(func(pos []byte) {
+		p.flushLSN.Store(binary.BigEndian.Uint64(pos))
+	})
+
+	if src.Replication != nil {
+		p.slot = src.Replication.Slot
+		p.publication = src.Replication.Publication
+	}
+
+	return p
+}
+
+func (p *pgoutputStreamer) Subscribe(ctx context.Context, table string) (<-chan func() (WatcherType, WatchResult), error) {
+	if err := p.preparePublication(ctx, table); err != nil {
+		return nil, err
+	}
+
+	return p.watchers.subscribe(ctx, table, func() error {
+		if err := p.prepareSlot(ctx); err != nil {
+			return err
+		}
+		go p.run(ctx)
+		return nil
+	})
+}
+
+// preparePublication creates publication if not exists and adds table to it,
+// publication maybe created by another bridge meanwhile so duplicate error is
+// ignored.
+func (p *pgoutputStreamer) preparePublication(ctx context.Context, table string) error {
+	p.pubMu.Lock()
+	defer p.pubMu.Unlock()
+
+	db := p.db.WithContext(ctx)
+	publication := pgx.Identifier{p.publication}.Sanitize()
+
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM pg_publication WHERE pubname = ?", p.publication).
+		Row().Scan(&count); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err := db.Exec(fmt.Sprintf("CREATE PUBLICATION %s", publication)).Error
+		if err != nil && !isDuplicateObject(err) {
+			return err
+		}
+	}
+
+	if err := db.Raw("SELECT count(*) FROM pg_publication_tables WHERE pubname = ? "+
+		"AND (tablename = ? OR schemaname || '.' || tablename = ?)", p.publication, table, table).
+		Row().Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	err := db.Exec(fmt.Sprintf("ALTER PUBLICATION %s ADD TABLE %s",
+		publication, pgx.Identifier(strings.Split(table, ".")).Sanitize())).Error
+	if err != nil && !isDuplicateObject(err) {
+		return err
+	}
+
+	return nil
+}
+
+func isDuplicateObject(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42710"
+}
+
+// prepareSlot creates logical replication slot if not exists, existing slot
+// continues from its confirmed position.
+func (p *pgoutputStreamer) prepareSlot(ctx context.Context) error {
+	db := p.db.WithContext(ctx)
+
+	var plugin string
+	err := db.Raw("SELECT plugin FROM pg_replication_slots WHERE slot_name = ?", p.slot).Row().Scan(&plugin)
+	switch {
+	case err == nil:
+		if plugin != "pgoutput" {
+			return fmt.Errorf("replication slot %s uses %s plugin, pgoutput is required", p.slot, plugin)
+		}
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return db.Exec("SELECT pg_create_logical_replication_slot(?, 'pgoutput')", p.slot).Error
+	default:
+		return err
+	}
+}
+
+func (p *pgoutputStreamer) run(ctx context.Context) {
+	defer p.watchers.close()
+
+	ctx, cancel := p.watchers.context(ctx)
+	defer cancel()
+
+	for {
+		err := p.stream(ctx)
+		if err := p.watchers.err(); err != nil {
+			p.log.Error("postgres replication stream stopped, change isn't written to index",
+				"slot", p.slot, "lsn", formatLSN(p.flushLSN.Load()), "err", err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		p.log.Error("postgres replication stream interrupted, trying to reconnect...",
+			"slot", p.slot, "lsn", formatLSN(p.flushLSN.Load()), "err", err)
+
+		t := time.NewTimer(_pgRetryWait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *pgoutputStreamer) stream(ctx context.Context) error {
+	conn, err := pgconn.Connect(ctx, dsnMaker(p.src)+" replication=database")
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	// stream starts from confirmed position of slot
+	query := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL 0/0 (proto_version '1', publication_names %s)",
+		pgx.Identifier{p.slot}.Sanitize(), quoteLiteral(pgx.Identifier{p.publication}.Sanitize()))
+	conn.Frontend().SendQuery(&pgproto3.Query{String: query})
+	if err := conn.Frontend().Flush(); err != nil {
+		return err
+	}
+
+	if err := waitCopyBoth(ctx, conn); err != nil {
+		return err
+	}
+
+	p.log.Info("started postgres replication stream", "slot", p.slot, "publication", p.publication)
+
+	// interrupted transaction is sent again from its begin
+	p.inTx = false
+
+	nextStatus := time.Now().Add(_standbyStatusInterval)
+	for {
+		if time.Now().After(nextStatus) {
+			if err := p.sendStandbyStatus(conn); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(_standbyStatusInterval)
+		}
+
+		rctx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := conn.ReceiveMessage(rctx)
+		cancel()
+		if err != nil {
+			if pgconn.Timeout(err) && ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+
+		switch m := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(m)
+		case *pgproto3.CopyData:
+			if len(m.Data) == 0 {
+				continue
+			}
+
+			switch m.Data[0] {
+			case _pgKeepaliveMessage:
+				// wal end(8) + server time(8) + reply requested(1)
+				if len(m.Data) < 18 {
+					return errMalformedEvent
+				}
+
+				p.handleKeepalive(binary.BigEndian.Uint64(m.Data[1:9]))
+				if m.Data[17] == 1 {
+					nextStatus = time.Time{}
+				}
+			case _pgXLogDataMessage:
+				// wal start(8) + wal end(8) + server time(8)
+				if len(m.Data) < 25 {
+					return errMalformedEvent
+				}
+
+				// failed message stops stream before its transaction is committed,
+				// so slot isn't confirmed past it
+				if err := p.handleMessage(ctx, m.Data[25:]); err != nil {
+					return fmt.Errorf("failed to handle replication message: %w", err)
+				}
+			}
+		}
+	}
+}
+
+func waitCopyBoth(ctx context.Context, conn *pgconn.PgConn) error {
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(m)
+		}
+	}
+}
+
+func (p *pgoutputStreamer) sendStandbyStatus(conn *pgconn.PgConn) error {
+	lsn := p.flushLSN.Load()
+
+	data := make([]byte, 34)
+	data[0] = _pgStandbyStatusMessage
+	binary.BigEndian.PutUint64(data[1:], lsn)
+	binary.BigEndian.PutUint64(data[9:], lsn)
+	binary.BigEndian.PutUint64(data[17:], lsn)
+	binary.BigEndian.PutUint64(data[25:], uint64(time.Since(_pgEpoch).Microseconds()))
+
+	conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	return conn.Frontend().Flush()
+}
+
+func (p *pgoutputStreamer) handleMessage(ctx context.Context, data []byte) error {
+	msg, err := parsePgoutputMessage(data)
+	if err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case 'B':
+		p.inTx = true
+	case 'R':
+		p.relations[msg.Relation.ID] = msg.Relation
+	case 'I', 'U', 'D':
+		rel, ok := p.relations[msg.Change.RelationID]
+		if !ok {
+			return fmt.Errorf("unknown relation %d", msg.Change.RelationID)
+		}
+
+		table := p.watchedTable(rel)
+		if table == "" {
+			return nil
+		}
+
+		res := WatchResult{Document: relationToResult(rel, msg.Change.Tuple)}
+		if msg.Change.OldTuple != nil {
+			res.Before = relationToResult(rel, msg.Change.OldTuple)
+		}
+
+		p.watchers.dispatch(ctx, table, msg.Change.Type, res)
+	case 'C':
+		// end of transaction is confirmed to server after its changes are applied
+		p.inTx = false
+		p.commit(msg.EndLSN)
+	}
+
+	return nil
+}
+
+// handleKeepalive confirms wal end of keepalive outside of transactions, all
+// changes before it are sent, so it's confirmed after they are applied. Without
+// it slot of quiet tables never advances, as empty transactions aren't sent.
+func (p *pgoutputStreamer) handleKeepalive(walEnd uint64) {
+	if p.inTx || walEnd <= p.flushLSN.Load() {
+		return
+	}
+	p.commit(walEnd)
+}
+
+func (p *pgoutputStreamer) commit(lsn uint64) {
+	pos := make([]byte, 8)
+	binary.BigEndian.PutUint64(pos, lsn)
+	p.watchers.commit(pos)
+}
+
+// watchedTable returns table name of watchers for relation, watchers maybe
+// subscribed with schema qualified name.
+func (p *pgoutputStreamer) watchedTable(rel *pgRelation) string {
+	qualified := rel.Namespace + "." + rel.Name
+	if p.watchers.has(qualified) {
+		return qualified
+	}
+
+	if rel.Namespace == "public" && p.watchers.has(rel.Name) {
+		return rel.Name
+	}
+
+	return ""
+}
+
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Ja7ad/meilibridge/config"
+	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParsePgoutputMessage(t *testing.T) {
+	relation := []byte{
+		'R',
+		0x00, 0x00, 0x40, 0x01, // relation id
+		'p', 'u', 'b', 'l', 'i', 'c', 0x00, // namespace
+		'u', 's', 'e', 'r', 0x00, // relation name
+		'd',        // replica identity
+		0x00, 0x02, // columns
+		0x01, 'i', 'd', 0x00, 0x00, 0x00, 0x00, 0x17, 0xff, 0xff, 0xff, 0xff, // id int4
+		0x00, 'n', 'a', 'm', 'e', 0x00, 0x00, 0x00, 0x00, 0x19, 0xff, 0xff, 0xff, 0xff, // name text
+	}
+
+	msg, err := parsePgoutputMessage(relation)
+	require.NoError(t, err)
+	require.NotNil(t, msg.Relation)
+	assert.Equal(t, uint32(0x4001), msg.Relation.ID)
+	assert.Equal(t, "public", msg.Relation.Namespace)
+	assert.Equal(t, "user", msg.Relation.Name)
+	assert.Equal(t, []pgColumn{{Name: "id", TypeOID: 23}, {Name: "name", TypeOID: 25}}, msg.Relation.Columns)
+
+	rel := msg.Relation
+
+	tests := []struct {
+		Name     string
+		Data     []byte
+		WType    WatcherType
+		Excepted Result
+		Old      Result
+	}{
+		{
+			Name: "insert",
+			Data: []byte{
+				'I', 0x00, 0x00, 0x40, 0x01, 'N', 0x00, 0x02,
+				't', 0x00, 0x00, 0x00, 0x01, '7',
+				't', 0x00, 0x00, 0x00, 0x03, 'b', 'o', 'b',
+			},
+			WType:    OnInsert,
+			Excepted: Result{"id": int64(7), "name": "bob"},
+		},
+		{
+			Name: "update with old key",
+			Data: []byte{
+				'U', 0x00, 0x00, 0x40, 0x01,
+				'K', 0x00, 0x02, 't', 0x00, 0x00, 0x00, 0x01, '6', 'n',
+				'N', 0x00, 0x02, 't', 0x00, 0x00, 0x00, 0x01, '7', 'u',
+			},
+			WType:    OnUpdate,
+			Excepted: Result{"id": int64(7)},
+			Old:      Result{"id": int64(6), "name": nil},
+		},
+		{
+			Name: "delete",
+			Data: []byte{
+				'D', 0x00, 0x00, 0x40, 0x01, 'K', 0x00, 0x02,
+				't', 0x00, 0x00, 0x00, 0x01, '7', 'n',
+			},
+			WType:    OnDelete,
+			Excepted: Result{"id": int64(7), "name": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			msg, err := parsePgoutputMessage(tt.Data)
+			require.NoError(t, err)
+			require.NotNil(t, msg.Change)
+			assert.Equal(t, tt.WType, msg.Change.Type)
+			assert.Equal(t, tt.Excepted, relationToResult(rel, msg.Change.Tuple))
+			if tt.Old != nil {
+				assert.Equal(t, tt.Old, relationToResult(rel, msg.Change.OldTuple))
+			}
+		})
+	}
+}
+
+func Test_ParsePgoutputCommit(t *testing.T) {
+	data := []byte{
+		'C', 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // commit lsn
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x30, // end lsn
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // commit time
+	}
+
+	msg, err := parsePgoutputMessage(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x1000030), msg.EndLSN)
+	assert.Equal(t, "0/1000030", formatLSN(msg.EndLSN))
+}
+
+func Test_PgoutputKeepalive(t *testing.T) {
+	p := newPgoutputStreamer(&config.Database{}, nil, logger.DefaultLogger)
+
+	commit := []byte{
+		'C', 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // commit lsn
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x30, // end lsn
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // commit time
+	}
+
+	// wal end inside of transaction isn't confirmed
+	require.NoError(t, p.handleMessage(context.Background(), []byte{'B'}))
+	p.handleKeepalive(0x1000020)
+	assert.Equal(t, uint64(0), p.flushLSN.Load())
+
+	require.NoError(t, p.handleMessage(context.Background(), commit))
+	assert.Equal(t, uint64(0x1000030), p.flushLSN.Load())
+
+	// quiet slot advances by keepalive
+	p.handleKeepalive(0x1000040)
+	assert.Equal(t, uint64(0x1000040), p.flushLSN.Load())
+
+	p.handleKeepalive(0x1000010)
+	assert.Equal(t, uint64(0x1000040), p.flushLSN.Load())
+}
+
+func Test_PgoutputUnknownRelation(t *testing.T) {
+	p := newPgoutputStreamer(&config.Database{}, nil, logger.DefaultLogger)
+
+	insert := []byte{
+		'I', 0x00, 0x00, 0x40, 0x01, 'N', 0x00, 0x01,
+		't', 0x00, 0x00, 0x00, 0x01, '7',
+	}
+
+	assert.Error(t, p.handleMessage(context.Background(), insert))
+}
+
+func Test_DecodePgText(t *testing.T) {
+	tests := []struct {
+		Name     string
+		TypeOID  uint32
+		Data     string
+		Excepted any
+	}{
+		{"bool", _pgBoolOID, "t", true},
+		{"int8", _pgInt8OID, "-42", int64(-42)},
+		{"float8", _pgFloat8OID, "1.5", 1.5},
+		{"timestamp", _pgTimestampOID, "2023-07-20 14:30:00", time.Date(2023, 7, 20, 14, 30, 0, 0, time.UTC)},
+		{"timestamptz", _pgTimestampTzOID, "2023-07-20 14:30:00+00", time.Date(2023, 7, 20, 14, 30, 0, 0, time.UTC)},
+		{"numeric", 1700, "1000.50", "1000.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			v := decodePgText(tt.TypeOID, []byte(tt.Data))
+			if tm, ok := v.(time.Time); ok {
+				assert.True(t, tm.Equal(tt.Excepted.(time.Time)))
+				return
+			}
+			assert.Equal(t, tt.Excepted, v)
+		})
+	}
+}
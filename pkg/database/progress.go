@@ -0,0 +1,109 @@
+package database
+
+import "sync"
+
+// Progress confirms positions of stream in order of its events, position is
+// confirmed when its event and all events before it are acknowledged by their
+// consumers. Failed event stops confirming and closes Failed, owner of stream
+// must stop it, so stream resumes from position before failed event after restart.
+type Progress struct {
+	mu      sync.Mutex
+	confirm func(pos []byte)
+	next    uint64
+	low     uint64
+	events  map[uint64]*progressEvent
+	err     error
+	failed  chan struct{}
+}
+
+type progressEvent struct {
+	pos     []byte
+	pending int
+}
+
+func NewProgress(confirm func(pos []byte)) *Progress {
+	return &Progress{
+		confirm: confirm,
+		events:  make(map[uint64]*progressEvent),
+		failed:  make(chan struct{}),
+	}
+}
+
+// Failed returns channel which is closed when an event fails.
+func (p *Progress) Failed() <-chan struct{} {
+	return p.failed
+}
+
+// Err returns error of failed event.
+func (p *Progress) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Add registers next event of stream with its position, nil position isn't a
+// resume point. Returned ack must be called once by each of consumers, event
+// without consumers is done.
+func (p *Progress) Add(pos []byte, consumers int) func(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := p.next
+	p.next++
+
+	if p.err != nil {
+		return func(error) {}
+	}
+
+	p.events[seq] = &progressEvent{pos: pos, pending: consumers}
+	p.advanceLocked()
+
+	return func(err error) {
+		p.ack(seq, err)
+	}
+}
+
+func (p *Progress) ack(seq uint64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return
+	}
+
+	if err != nil {
+		p.err = err
+		p.events = nil
+		close(p.failed)
+		return
+	}
+
+	ev, ok := p.events[seq]
+	if !ok {
+		return
+	}
+	ev.pending--
+
+	p.advanceLocked()
+}
+
+func (p *Progress) advanceLocked() {
+	var pos []byte
+	for {
+		ev, ok := p.events[p.low]
+		if !ok || ev.pending > 0 {
+			break
+		}
+
+		delete(p.events, p.low)
+		p.low++
+
+		if ev.pos != nil {
+			pos = ev.pos
+		}
+	}
+
+	if pos != nil {
+		p.confirm(pos)
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Progress(t *testing.T) {
+	var confirmed []string
+	p := NewProgress(func(pos []byte) {
+		confirmed = append(confirmed, string(pos))
+	})
+
+	ack1 := p.Add(nil, 2)
+	ack2 := p.Add(nil, 1)
+	p.Add([]byte("1"), 0)
+	ack3 := p.Add([]byte("2"), 1)
+
+	// later event is acknowledged first, position waits for earlier ones
+	ack2(nil)
+	ack1(nil)
+	assert.Empty(t, confirmed)
+
+	ack1(nil)
+	assert.Equal(t, []string{"1"}, confirmed)
+
+	ack3(nil)
+	assert.Equal(t, []string{"1", "2"}, confirmed)
+}
+
+func Test_ProgressFailed(t *testing.T) {
+	var confirmed []string
+	p := NewProgress(func(pos []byte) {
+		confirmed = append(confirmed, string(pos))
+	})
+
+	ack1 := p.Add([]byte("1"), 1)
+	ack2 := p.Add([]byte("2"), 1)
+
+	select {
+	case <-p.Failed():
+		t.Fatal("progress is failed before failed event")
+	default:
+	}
+
+	ack1(errors.New("failed"))
+	ack2(nil)
+	p.Add([]byte("3"), 0)
+
+	assert.Empty(t, confirmed)
+	assert.EqualError(t, p.Err(), "failed")
+
+	select {
+	case <-p.Failed():
+	default:
+		t.Fatal("progress isn't failed after failed event")
+	}
+}
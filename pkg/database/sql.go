@@ -2,18 +2,28 @@ package database
 
 import (
 	"context"
-	"math"
+	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// _subqueryAlias is name of derived table of query source.
+const _subqueryAlias = "_source"
+
 type SQL struct {
-	db  *gorm.DB
-	log logger.Logger
+	db       *gorm.DB
+	log      logger.Logger
+	src      *config.Database
+	mu       *sync.Mutex
+	binlog   *binlogStreamer
+	pgoutput *pgoutputStreamer
 }
 
 func newSQL(
@@ -22,6 +32,8 @@ func newSQL(
 ) (SQLExecutor, error) {
 	s := &SQL{
 		log: log,
+		src: src,
+		mu:  new(sync.Mutex),
 	}
 
 	dsn := dsnMaker(src)
@@ -52,14 +64,14 @@ func (s *SQL) Close() error {
 	return sq.Close()
 }
 
-func (s *SQL) Count(ctx context.Context, table string) (int64, error) {
+func (s *SQL) Count(ctx context.Context, table string, filter *Filter) (int64, error) {
 	var count int64
-	db := s.db.WithContext(ctx).Table(table)
+	db := applyFilter(s.db.WithContext(ctx).Table(table), filter)
 	return count, db.Count(&count).Error
 }
 
-func (s *SQL) FindOne(ctx context.Context, table string, query map[string]interface{}) (Result, error) {
-	queryStr, args := buildQueryFindOne(table, query)
+func (s *SQL) FindOne(ctx context.Context, table string, query map[string]interface{}, filter *Filter) (Result, error) {
+	queryStr, args := buildQueryFindOne(table, query, filter)
 
 	rows, err := s.db.WithContext(ctx).Raw(queryStr, args...).Rows()
 	if err != nil {
@@ -78,71 +90,235 @@ func (s *SQL) FindOne(ctx context.Context, table string, query map[string]interf
 	return nil, err
 }
 
-func (s *SQL) FindLimit(ctx context.Context, table string, limit int64) (Cursor, error) {
-	count, err := s.Count(ctx, table)
-	if err != nil {
-		return nil, err
+// FindLimit pages table ordered by keys with keyset pagination, every page
+// continues after last key of previous page. Many keys are compared as row value.
+func (s *SQL) FindLimit(ctx context.Context, table string, keys []string, limit int64, since *Watermark, filter *Filter) (Cursor, error) {
+	if len(keys) == 0 {
+		return nil, ErrCursorKeyRequire
 	}
 
-	totalPages := int64(math.Ceil(float64(count) / float64(limit)))
+	for _, key := range keys {
+		if key == "" {
+			return nil, ErrCursorKeyRequire
+		}
+	}
 
 	return &sqlCursor{
-		total: count,
-		pages: int(totalPages),
-		page:  0,
-		limit: int(limit),
-		db:    s.db,
-		table: table,
-		err:   nil,
+		limit:  int(limit),
+		db:     s.db,
+		table:  table,
+		keys:   keys,
+		since:  since,
+		filter: filter,
+		err:    nil,
 	}, nil
 }
 
+// Max returns maximum value of column in table, nil if table is empty.
+func (s *SQL) Max(ctx context.Context, table, column string) (any, error) {
+	rows, err := s.db.WithContext(ctx).
+		Table(table).
+		Select("MAX(?) AS max_value", clause.Column{Name: column}).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	data, err := decodeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapToResult(data)["max_value"], nil
+}
+
+// FindMany returns rows of table which column is one of values.
+func (s *SQL) FindMany(ctx context.Context, table, column string, values []any, filter *Filter) ([]*Result, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	rows, err := applyFilter(s.db.WithContext(ctx).Table(table), filter).
+		Where(clause.IN{Column: clause.Column{Name: column}, Values: values}).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*Result, 0, len(values))
+	for rows.Next() {
+		data, err := decodeRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		res := mapToResult(data)
+		results = append(results, &res)
+	}
+
+	return results, rows.Err()
+}
+
+// Exists returns values which exist in column of table.
+func (s *SQL) Exists(ctx context.Context, table, column string, values []any, filter *Filter) ([]any, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	rows, err := applyFilter(s.db.WithContext(ctx).Table(table), filter).
+		Select(clause.Column{Name: column}).
+		Where(clause.IN{Column: clause.Column{Name: column}, Values: values}).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make([]any, 0, len(values))
+	for rows.Next() {
+		var v any
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		found = append(found, v)
+	}
+
+	return found, rows.Err()
+}
+
+func (s *SQL) Watcher(ctx context.Context, table string, cp Checkpoint) (<-chan func() (WatcherType, WatchResult), error) {
+	switch s.src.Engine {
+	case config.MYSQL:
+		s.mu.Lock()
+		if s.binlog == nil {
+			s.binlog = newBinlogStreamer(s.src, s.db, s.log)
+		}
+		s.mu.Unlock()
+
+		return s.binlog.Subscribe(ctx, table, cp)
+	case config.POSTGRES:
+		s.mu.Lock()
+		if s.pgoutput == nil {
+			s.pgoutput = newPgoutputStreamer(s.src, s.db, s.log)
+		}
+		s.mu.Unlock()
+
+		return s.pgoutput.Subscribe(ctx, table)
+	default:
+		return nil, ErrRealtimeNotSupported
+	}
+}
+
 type sqlCursor struct {
-	total int64
-	pages int
-	page  int
-	limit int
-	db    *gorm.DB
-	table string
-	err   error
-	res   []*Result
+	limit  int
+	db     *gorm.DB
+	table  string
+	keys   []string
+	since  *Watermark
+	filter *Filter
+	last   []any
+	done   bool
+	err    error
+	res    []*Result
 }
 
 func (c *sqlCursor) Next(ctx context.Context) bool {
-	if c.page >= c.pages {
+	if c.done {
 		return false
 	}
 
-	if len(c.res) != 0 {
-		c.res = make([]*Result, 0)
+	c.res = make([]*Result, 0, c.limit)
+
+	db := applyFilter(c.db.WithContext(ctx).Table(c.table), c.filter)
+	if c.since != nil && c.since.Value != nil {
+		db = db.Where(clause.Gte{Column: clause.Column{Name: c.since.Column}, Value: c.since.Value})
+	}
+	if c.last != nil {
+		db = db.Where(keysetAfter(c.keys, c.last))
 	}
 
-	skip := c.page * c.limit
+	orderBy := clause.OrderBy{Columns: make([]clause.OrderByColumn, 0, len(c.keys))}
+	for _, key := range c.keys {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Name: key}})
+	}
 
-	rows, err := c.db.WithContext(ctx).Table(c.table).Offset(skip).Limit(c.limit).Rows()
+	rows, err := db.Order(orderBy).
+		Limit(c.limit).
+		Rows()
 	if err != nil {
 		c.err = err
 		return false
 	}
 	defer rows.Close()
 
-	for i := 0; i < c.limit; i++ {
-		for rows.Next() {
-			data, err := decodeRows(rows)
-			if err != nil {
-				c.err = err
+	for rows.Next() {
+		data, err := decodeRows(rows)
+		if err != nil {
+			c.err = err
+			return false
+		}
+
+		last := make([]any, 0, len(c.keys))
+		for _, key := range c.keys {
+			v, ok := data[key]
+			if !ok {
+				c.err = fmt.Errorf("%w: %s", ErrCursorKeyNotFound, key)
 				return false
 			}
-			res := mapToResult(data)
-			c.res = append(c.res, &res)
-
+			last = append(last, v)
 		}
+		c.last = last
+
+		res := mapToResult(data)
+		c.res = append(c.res, &res)
+	}
+
+	if c.err = rows.Err(); c.err != nil {
+		return false
+	}
+
+	if len(c.res) < c.limit {
+		c.done = true
 	}
 
-	c.page++
-	return true
+	return len(c.res) > 0
 }
 
 func (c *sqlCursor) Result() ([]*Result, error) {
 	return c.res, c.err
 }
+
+// keysetAfter returns condition of rows after last values of keys, many keys are
+// compared as row value (a, b) > (?, ?).
+func keysetAfter(keys []string, last []any) clause.Expression {
+	if len(keys) == 1 {
+		return clause.Gt{Column: clause.Column{Name: keys[0]}, Value: last[0]}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	vars := make([]any, 0, len(keys)*2)
+	for _, key := range keys {
+		vars = append(vars, clause.Column{Name: key})
+	}
+	vars = append(vars, last...)
+
+	return clause.Expr{SQL: "(" + placeholders + ") > (" + placeholders + ")", Vars: vars}
+}
+
+// applyFilter adds WHERE fragment of filter to query, fragment is wrapped in
+// parentheses so OR doesn't leak to other conditions.
+func applyFilter(db *gorm.DB, filter *Filter) *gorm.DB {
+	if filter == nil || filter.Query == "" {
+		return db
+	}
+
+	return db.Where("("+filter.Query+")", filter.Args...)
+}
@@ -9,12 +9,21 @@ import (
 type (
 	Result      map[string]interface{}
 	WatchResult struct {
-		DocumentId primitive.ObjectID
+		// DocumentId is raw _id of changed document, object id, string, number or binary.
+		DocumentId any
 		Document   Result
-		Update     struct {
+		// ResumeToken is change stream token of event for resuming watcher after it.
+		ResumeToken []byte
+		Update      struct {
 			UpdateFields Result
 			RemoveFields []string
 		}
+		// Before is before image of changed sql row or pre-image of mongo document,
+		// it's nil if source doesn't send it.
+		Before Result
+		// Ack acknowledges that change is applied, so position of stream can pass
+		// it. It's nil if stream doesn't track changes.
+		Ack func(err error)
 	}
 	WatcherType uint8
 )
@@ -42,16 +51,31 @@ func (w WatcherType) String() string {
 	}
 }
 
+// Watermark limits cursor to rows whose Column is greater than or equal to Value.
+type Watermark struct {
+	Column string
+	Value  any
+}
+
+// Filter limits rows of table by WHERE fragment, Args are bound to ? placeholders
+// of Query.
+type Filter struct {
+	Query string
+	Args  []any
+}
+
 type Cursor interface {
 	Next(ctx context.Context) bool
 	Result() ([]*Result, error)
 }
 
 type mongoChangeEvent struct {
-	OperationType     string             `bson:"operationType" json:"operationType"`
-	DocumentKey       primitive.ObjectID `bson:"documentKey" json:"documentKey"`
-	FullDocument      Result             `bson:"fullDocument" json:"fullDocument"`
-	UpdateDescription struct {
+	OperationType string `bson:"operationType" json:"operationType"`
+	DocumentKey   any    `bson:"documentKey" json:"documentKey"`
+	FullDocument  Result `bson:"fullDocument" json:"fullDocument"`
+	// FullDocumentBeforeChange is pre-image of document if it's requested and available
+	FullDocumentBeforeChange Result `bson:"fullDocumentBeforeChange" json:"fullDocumentBeforeChange"`
+	UpdateDescription        struct {
 		UpdatedFields Result   `bson:"updatedFields" json:"updatedFields"`
 		RemovedFields []string `bson:"removedFields" json:"removedFields"`
 	} `bson:"updateDescription" json:"updateDescription"`
@@ -65,17 +89,43 @@ type MongoExecutor interface {
 	GlobalExecutor
 
 	AddCollection(col string)
-	Count(ctx context.Context, col string) (int64, error)
+	Count(ctx context.Context, col string, filter any) (int64, error)
 	FindOne(ctx context.Context, filter interface{}, col string) (Result, error)
-	FindLimit(ctx context.Context, limit int64, col string) (Cursor, error)
-	Watcher(ctx context.Context, col string) (<-chan func() (WatcherType, WatchResult), error)
+	FindLimit(ctx context.Context, limit int64, col string, since *Watermark, filter any) (Cursor, error)
+	Max(ctx context.Context, col, field string) (any, error)
+	Exists(ctx context.Context, col, field string, values []any, filter any) ([]any, error)
+	FindMany(ctx context.Context, col, field string, values []any, filter any) ([]*Result, error)
+	Aggregate(ctx context.Context, col string, match any, pipeline []any) ([]*Result, error)
+	AggregateLimit(ctx context.Context, limit int64, col string, since *Watermark, filter any, pipeline []any) (Cursor, error)
+	OperationTime(ctx context.Context) (primitive.Timestamp, error)
+	Watcher(ctx context.Context, col string, start StreamStart, filter any) (<-chan func() (WatcherType, WatchResult), error)
+}
+
+// StreamStart is position which change stream starts from, resume token has
+// priority over operation time and zero value starts from now. PreImage requests
+// document before change as Before of result, it needs mongo 6.0 and collection
+// with changeStreamPreAndPostImages, otherwise Before is empty.
+type StreamStart struct {
+	ResumeToken   []byte
+	OperationTime *primitive.Timestamp
+	PreImage      bool
 }
 
 type SQLExecutor interface {
 	GlobalExecutor
 
-	Count(ctx context.Context, table string) (int64, error)
-	FindOne(ctx context.Context, table string, query map[string]interface{}) (Result, error)
-	FindLimit(ctx context.Context, table string, limit int64) (Cursor, error)
-	// TODO: support trigger for realtime sync
+	Count(ctx context.Context, table string, filter *Filter) (int64, error)
+	FindOne(ctx context.Context, table string, query map[string]interface{}, filter *Filter) (Result, error)
+	FindLimit(ctx context.Context, table string, keys []string, limit int64, since *Watermark, filter *Filter) (Cursor, error)
+	Max(ctx context.Context, table, column string) (any, error)
+	Exists(ctx context.Context, table, column string, values []any, filter *Filter) ([]any, error)
+	FindMany(ctx context.Context, table, column string, values []any, filter *Filter) ([]*Result, error)
+	Watcher(ctx context.Context, table string, cp Checkpoint) (<-chan func() (WatcherType, WatchResult), error)
+}
+
+// Checkpoint keeps position of replication stream between restarts, e.g. mysql
+// binlog position. Streams which keep position in source don't use it.
+type Checkpoint interface {
+	Load(key string) []byte
+	Save(key string, pos []byte)
 }
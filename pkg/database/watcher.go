@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"sync"
+)
+
+type tableSubscriber struct {
+	ctx context.Context
+	ch  chan func() (WatcherType, WatchResult)
+}
+
+// tableWatchers dispatches change events of sql tables to watchers, a single
+// replication stream is shared between all tables of database. Position of
+// stream is confirmed when watchers acknowledge all changes before it.
+type tableWatchers struct {
+	mu          sync.RWMutex
+	started     bool
+	subscribers map[string][]*tableSubscriber
+	progress    *Progress
+}
+
+func newTableWatchers(confirm func(pos []byte)) *tableWatchers {
+	return &tableWatchers{
+		subscribers: make(map[string][]*tableSubscriber),
+		progress:    NewProgress(confirm),
+	}
+}
+
+// subscribe registers watcher for table, start is called once for first watcher.
+func (w *tableWatchers) subscribe(
+	ctx context.Context,
+	table string,
+	start func() error,
+) (<-chan func() (WatcherType, WatchResult), error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.started {
+		if err := start(); err != nil {
+			return nil, err
+		}
+		w.started = true
+	}
+
+	sub := &tableSubscriber{
+		ctx: ctx,
+		ch:  make(chan func() (WatcherType, WatchResult)),
+	}
+	w.subscribers[table] = append(w.subscribers[table], sub)
+
+	return sub.ch, nil
+}
+
+func (w *tableWatchers) has(table string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.subscribers[table]
+	return ok
+}
+
+// dispatch sends change of table to its watchers, every watcher acknowledges
+// change by Ack of result when it's applied.
+func (w *tableWatchers) dispatch(ctx context.Context, table string, wType WatcherType, res WatchResult) {
+	w.mu.RLock()
+	subs := w.subscribers[table]
+	w.mu.RUnlock()
+
+	res.Ack = w.progress.Add(nil, len(subs))
+	ev := func() (WatcherType, WatchResult) {
+		return wType, res
+	}
+
+	for _, sub := range subs {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.ctx.Done():
+			// change isn't applied, so position doesn't pass it
+			res.Ack(sub.ctx.Err())
+		case sub.ch <- ev:
+		}
+	}
+}
+
+// commit adds resume position of stream, it's confirmed after changes before it.
+func (w *tableWatchers) commit(pos []byte) {
+	w.progress.Add(pos, 0)
+}
+
+// context returns context of stream which is canceled when a change fails, so
+// stream stops before its position is passed.
+func (w *tableWatchers) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.progress.Failed():
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// err returns error of failed change.
+func (w *tableWatchers) err() error {
+	return w.progress.Err()
+}
+
+func (w *tableWatchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for table, subs := range w.subscribers {
+		for _, sub := range subs {
+			close(sub.ch)
+		}
+		delete(w.subscribers, table)
+	}
+	w.started = false
+}
@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"github.com/Ja7ad/meilibridge/config"
 	"github.com/Ja7ad/meilibridge/pkg/logger"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	meili "github.com/meilisearch/meilisearch-go"
@@ -16,8 +20,10 @@ const _defaultWaitInterval = 5 * time.Second
 type meilisearch struct {
 	apiURL, apiKey string
 	cli            meili.ServiceManager
-	isHealthy      bool
-	log            logger.Logger
+	// client is http client of cli, requests which sdk doesn't cover share it
+	client    *http.Client
+	isHealthy bool
+	log       logger.Logger
 }
 
 type Meilisearch interface {
@@ -26,6 +32,8 @@ type Meilisearch interface {
 	GetIndex(ctx context.Context, uid string) (meili.IndexManager, error)
 	IsExistsIndex(ctx context.Context, uid string) bool
 	DeleteIndex(ctx context.Context, uid string) error
+	SwapIndexes(ctx context.Context, first, second string) error
+	DocumentKeys(ctx context.Context, uid, primaryKey string, offset, limit int64) ([]any, error)
 	UpdateIndexSettings(ctx context.Context, uid string, settings *config.Settings) error
 	WaitForTask(ctx context.Context, task *meili.TaskInfo) error
 	Stats(ctx context.Context) *meili.Stats
@@ -34,7 +42,9 @@ type Meilisearch interface {
 }
 
 func New(ctx context.Context, apiURL, apiKey string, log logger.Logger) (Meilisearch, error) {
-	cli, err := meili.Connect(apiURL, meili.WithAPIKey(apiKey))
+	client := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+
+	cli, err := meili.Connect(apiURL, meili.WithAPIKey(apiKey), meili.WithCustomClient(client))
 	if err != nil {
 		select {
 		case <-ctx.Done():
@@ -52,6 +62,7 @@ func New(ctx context.Context, apiURL, apiKey string, log logger.Logger) (Meilise
 		log:       log,
 		apiURL:    apiURL,
 		apiKey:    apiKey,
+		client:    client,
 		isHealthy: true,
 	}
 
@@ -118,6 +129,89 @@ func (m *meilisearch) DeleteIndex(ctx context.Context, uid string) error {
 	return m.WaitForTask(ctx, t)
 }
 
+func (m *meilisearch) SwapIndexes(ctx context.Context, first, second string) error {
+	if !m.isHealthy {
+		return ErrMeilisearchIsUnhealthy
+	}
+
+	t, err := m.cli.SwapIndexesWithContext(ctx, []*meili.SwapIndexesParams{
+		{Indexes: []string{first, second}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.WaitForTask(ctx, t)
+}
+
+// DocumentKeys returns primary keys of page of documents of index, integer keys
+// are decoded as int64, so large ids don't lose precision like float64. Sdk
+// decodes numbers as float64, so request is sent by http client of sdk.
+func (m *meilisearch) DocumentKeys(ctx context.Context, uid, primaryKey string, offset, limit int64) ([]any, error) {
+	if !m.isHealthy {
+		return nil, ErrMeilisearchIsUnhealthy
+	}
+
+	u, err := url.JoinPath(m.apiURL, "indexes", uid, "documents")
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("offset", strconv.FormatInt(offset, 10))
+	q.Set("limit", strconv.FormatInt(limit, 10))
+	q.Set("fields", primaryKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to get documents of index %s: %s", uid, body)
+	}
+
+	var res struct {
+		Results []map[string]any `json:"results"`
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+
+	keys := make([]any, 0, len(res.Results))
+	for _, doc := range res.Results {
+		v, ok := doc[primaryKey]
+		if !ok {
+			continue
+		}
+
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else {
+				v, _ = n.Float64()
+			}
+		}
+		keys = append(keys, v)
+	}
+
+	return keys, nil
+}
+
 func (m *meilisearch) UpdateIndexSettings(ctx context.Context, uid string, settings *config.Settings) error {
 	idx, err := m.cli.GetIndexWithContext(ctx, uid)
 	if err != nil {
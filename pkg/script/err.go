@@ -0,0 +1,9 @@
+package script
+
+import "errors"
+
+var (
+	ErrTransformNotFound = errors.New("script must define transform(doc) function")
+	ErrTimeout           = errors.New("script timeout")
+	ErrInvalidResult     = errors.New("script must return dict, list of dicts or None")
+)
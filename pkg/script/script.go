@@ -0,0 +1,251 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.starlark.net/starlark"
+)
+
+const (
+	_transformFunc  = "transform"
+	_defaultTimeout = time.Second
+)
+
+// Script is compiled Starlark script which defines transform(doc) function, it's
+// safe for concurrent use. transform returns dict for one document, list of
+// dicts to fan out document or None to drop it.
+type Script struct {
+	name    string
+	fn      starlark.Callable
+	timeout time.Duration
+}
+
+func New(path string, timeout time.Duration) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compile(path, src, timeout)
+}
+
+// Compile compiles source of script, top level statements run once here.
+func Compile(name string, src []byte, timeout time.Duration) (*Script, error) {
+	if timeout <= 0 {
+		timeout = _defaultTimeout
+	}
+
+	thread := &starlark.Thread{Name: name, Print: func(*starlark.Thread, string) {}}
+
+	globals, err := starlark.ExecFile(thread, name, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	fn, ok := globals[_transformFunc].(starlark.Callable)
+	if !ok {
+		return nil, ErrTransformNotFound
+	}
+
+	return &Script{name: name, fn: fn, timeout: timeout}, nil
+}
+
+// Run calls transform with document and returns documents to push, empty result
+// means document is dropped.
+func (s *Script) Run(ctx context.Context, doc map[string]any) ([]map[string]any, error) {
+	arg, err := toValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &starlark.Thread{Name: s.name, Print: func(*starlark.Thread, string) {}}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(ctx.Err().Error())
+	})
+	defer stop()
+
+	res, err := starlark.Call(thread, s.fn, starlark.Tuple{arg}, nil)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%w after %s", ErrTimeout, s.timeout)
+		}
+		return nil, err
+	}
+
+	switch r := res.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *starlark.Dict:
+		d, err := fromDict(r)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]any{d}, nil
+	case *starlark.List:
+		docs := make([]map[string]any, 0, r.Len())
+		for i := 0; i < r.Len(); i++ {
+			item, ok := r.Index(i).(*starlark.Dict)
+			if !ok {
+				return nil, ErrInvalidResult
+			}
+
+			d, err := fromDict(item)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, d)
+		}
+		return docs, nil
+	}
+
+	return nil, ErrInvalidResult
+}
+
+// toValue converts Go value to Starlark, values which have no Starlark type
+// like dates and object ids are passed as string.
+func toValue(v any) (starlark.Value, error) {
+	switch x := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(x), nil
+	case int:
+		return starlark.MakeInt(x), nil
+	case int8:
+		return starlark.MakeInt64(int64(x)), nil
+	case int16:
+		return starlark.MakeInt64(int64(x)), nil
+	case int32:
+		return starlark.MakeInt64(int64(x)), nil
+	case int64:
+		return starlark.MakeInt64(x), nil
+	case uint:
+		return starlark.MakeUint(x), nil
+	case uint8:
+		return starlark.MakeUint64(uint64(x)), nil
+	case uint16:
+		return starlark.MakeUint64(uint64(x)), nil
+	case uint32:
+		return starlark.MakeUint64(uint64(x)), nil
+	case uint64:
+		return starlark.MakeUint64(x), nil
+	case float32:
+		return starlark.Float(x), nil
+	case float64:
+		return starlark.Float(x), nil
+	case string:
+		return starlark.String(x), nil
+	case []byte:
+		return starlark.String(x), nil
+	case time.Time:
+		return starlark.String(x.Format(time.RFC3339Nano)), nil
+	case primitive.DateTime:
+		return starlark.String(x.Time().UTC().Format(time.RFC3339Nano)), nil
+	case primitive.ObjectID:
+		return starlark.String(x.Hex()), nil
+	case primitive.D:
+		m := make(map[string]any, len(x))
+		for _, e := range x {
+			m[e.Key] = e.Value
+		}
+		return toValue(m)
+	case primitive.M:
+		return toValue(map[string]any(x))
+	case map[string]any:
+		d := starlark.NewDict(len(x))
+		for k, e := range x {
+			ev, err := toValue(e)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), ev); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case primitive.A:
+		return toValue([]any(x))
+	case []any:
+		l := make([]starlark.Value, 0, len(x))
+		for _, e := range x {
+			ev, err := toValue(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, ev)
+		}
+		return starlark.NewList(l), nil
+	}
+
+	return starlark.String(fmt.Sprintf("%v", v)), nil
+}
+
+func fromValue(v starlark.Value) (any, error) {
+	switch x := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(x), nil
+	case starlark.Int:
+		if i, ok := x.Int64(); ok {
+			return i, nil
+		}
+		return x.String(), nil
+	case starlark.Float:
+		return float64(x), nil
+	case starlark.String:
+		return string(x), nil
+	case *starlark.Dict:
+		return fromDict(x)
+	case *starlark.List:
+		l := make([]any, 0, x.Len())
+		for i := 0; i < x.Len(); i++ {
+			e, err := fromValue(x.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, e)
+		}
+		return l, nil
+	case starlark.Tuple:
+		l := make([]any, 0, len(x))
+		for _, e := range x {
+			ev, err := fromValue(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, ev)
+		}
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("unsupported script value type %s", v.Type())
+}
+
+func fromDict(d *starlark.Dict) (map[string]any, error) {
+	m := make(map[string]any, d.Len())
+
+	for _, item := range d.Items() {
+		k, ok := item[0].(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("document key must be string, got %s", item[0].Type())
+		}
+
+		v, err := fromValue(item[1])
+		if err != nil {
+			return nil, err
+		}
+		m[string(k)] = v
+	}
+
+	return m, nil
+}
@@ -0,0 +1,91 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const _testScript = `
+def transform(doc):
+    if doc.get("hidden"):
+        return None
+
+    if "tags" in doc:
+        return [{"id": "%s_%s" % (doc["id"], t), "tag": t} for t in doc["tags"]]
+
+    name, _, domain = doc["email"].partition("@")
+    doc["email"] = name[0] + "***@" + domain
+    doc["score"] = doc["views"] * 2 + len(doc["likes"])
+    return doc
+`
+
+func Test_ScriptRun(t *testing.T) {
+	sc, err := Compile("test.star", []byte(_testScript), time.Second)
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name     string
+		Document map[string]any
+		Excepted []map[string]any
+	}{
+		{
+			Name:     "modify",
+			Document: map[string]any{"id": 1, "email": "alice@example.com", "views": int64(10), "likes": []any{"a", "b"}},
+			Excepted: []map[string]any{
+				{"id": int64(1), "email": "a***@example.com", "views": int64(10), "likes": []any{"a", "b"}, "score": int64(22)},
+			},
+		},
+		{
+			Name:     "drop",
+			Document: map[string]any{"id": 1, "hidden": true},
+			Excepted: nil,
+		},
+		{
+			Name:     "fan out",
+			Document: map[string]any{"id": 1, "tags": []any{"x", "y"}},
+			Excepted: []map[string]any{
+				{"id": "1_x", "tag": "x"},
+				{"id": "1_y", "tag": "y"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			res, err := sc.Run(context.Background(), tt.Document)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Excepted, res)
+		})
+	}
+}
+
+func Test_ScriptTimeout(t *testing.T) {
+	sc, err := Compile("loop.star", []byte(`
+def transform(doc):
+    for i in range(100000000):
+        doc["i"] = i
+    return doc
+`), 50*time.Millisecond)
+	require.NoError(t, err)
+
+	_, err = sc.Run(context.Background(), map[string]any{"id": 1})
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func Test_ScriptCompile(t *testing.T) {
+	_, err := Compile("empty.star", []byte(`x = 1`), time.Second)
+	assert.ErrorIs(t, err, ErrTransformNotFound)
+
+	sc, err := Compile("invalid.star", []byte(`
+def transform(doc):
+    return 1
+`), time.Second)
+	require.NoError(t, err)
+
+	_, err = sc.Run(context.Background(), map[string]any{})
+	assert.ErrorIs(t, err, ErrInvalidResult)
+}
@@ -0,0 +1,5 @@
+package store
+
+import "errors"
+
+var ErrNotFound = errors.New("key not found")
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	seq     map[string]uint64
+}
+
+// memoryBucket keeps keys sorted, appended keys are largest so they're added to
+// end of keys.
+type memoryBucket struct {
+	values map[string][]byte
+	keys   []string
+}
+
+// NewMemory returns in-memory Store for bridges without storage, state is lost on exit.
+func NewMemory() Store {
+	return &memoryStore{
+		buckets: make(map[string]*memoryBucket),
+		seq:     make(map[string]uint64),
+	}
+}
+
+func (s *memoryStore) Get(bucket, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	v, ok := b.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), v...), nil
+}
+
+func (s *memoryStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(bucket, key, value)
+	return nil
+}
+
+func (s *memoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil
+	}
+
+	if _, ok := b.values[key]; !ok {
+		return nil
+	}
+	delete(b.values, key)
+
+	i := sort.SearchStrings(b.keys, key)
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+
+	return nil
+}
+
+func (s *memoryStore) Append(bucket string, value []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq[bucket]++
+	key := sequenceKey(s.seq[bucket])
+	s.put(bucket, key, value)
+
+	return key, nil
+}
+
+func (s *memoryStore) AppendAll(bucket string, values [][]byte) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(values))
+	for _, value := range values {
+		s.seq[bucket]++
+		key := sequenceKey(s.seq[bucket])
+		s.put(bucket, key, value)
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStore) Move(from, key, to string, value []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[from]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	if _, ok := b.values[key]; !ok {
+		return "", ErrNotFound
+	}
+	delete(b.values, key)
+
+	i := sort.SearchStrings(b.keys, key)
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+
+	s.seq[to]++
+	moved := sequenceKey(s.seq[to])
+	s.put(to, moved, value)
+
+	return moved, nil
+}
+
+func (s *memoryStore) First(bucket string) (string, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok || len(b.keys) == 0 {
+		return "", nil, ErrNotFound
+	}
+
+	key := b.keys[0]
+	return key, append([]byte(nil), b.values[key]...), nil
+}
+
+func (s *memoryStore) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	s.mu.Lock()
+	var (
+		keys   []string
+		values [][]byte
+	)
+	if b, ok := s.buckets[bucket]; ok {
+		keys = append([]string(nil), b.keys...)
+		values = make([][]byte, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, append([]byte(nil), b.values[k]...))
+		}
+	}
+	s.mu.Unlock()
+
+	for i, k := range keys {
+		if err := fn(k, values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) put(bucket, key string, value []byte) {
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = &memoryBucket{values: make(map[string][]byte)}
+		s.buckets[bucket] = b
+	}
+
+	if _, ok := b.values[key]; !ok {
+		i := sort.SearchStrings(b.keys, key)
+		b.keys = append(b.keys, "")
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+	}
+
+	b.values[key] = append([]byte(nil), value...)
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const _openTimeout = 5 * time.Second
+
+// Store is durable local key value store of bridge, it keeps sync state like
+// change stream resume tokens between restarts.
+type Store interface {
+	Get(bucket, key string) ([]byte, error)
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+	// Append puts value with next sequence key of bucket and returns the key,
+	// keys of appended values are sorted by insertion order.
+	Append(bucket string, value []byte) (string, error)
+	// AppendAll appends values in one write and returns their keys.
+	AppendAll(bucket string, values [][]byte) ([]string, error)
+	// Move deletes key from bucket and appends value to other bucket in one
+	// write, it returns key of appended value or ErrNotFound if key doesn't exist.
+	Move(from, key, to string, value []byte) (string, error)
+	// First returns smallest key of bucket and its value.
+	First(bucket string) (string, []byte, error)
+	// ForEach calls fn for every key of bucket in key order.
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	Close() error
+}
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func New(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: _openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *boltStore) Put(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *boltStore) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *boltStore) Append(bucket string, value []byte) (string, error) {
+	var key string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key = sequenceKey(seq)
+		return b.Put([]byte(key), value)
+	})
+	return key, err
+}
+
+func (s *boltStore) AppendAll(bucket string, values [][]byte) ([]string, error) {
+	keys := make([]string, 0, len(values))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			key := sequenceKey(seq)
+			if err := b.Put([]byte(key), value); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *boltStore) Move(from, key, to string, value []byte) (string, error) {
+	var moved string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		src := tx.Bucket([]byte(from))
+		if src == nil || src.Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+
+		if err := src.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		dst, err := tx.CreateBucketIfNotExists([]byte(to))
+		if err != nil {
+			return err
+		}
+
+		seq, err := dst.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		moved = sequenceKey(seq)
+		return dst.Put([]byte(moved), value)
+	})
+	return moved, err
+}
+
+func (s *boltStore) First(bucket string) (string, []byte, error) {
+	var (
+		key   string
+		value []byte
+	)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+
+		k, v := b.Cursor().First()
+		if k == nil {
+			return ErrNotFound
+		}
+
+		key = string(k)
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return key, value, err
+}
+
+func (s *boltStore) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), append([]byte(nil), v...))
+		})
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// sequenceKey pads sequence, so byte order of keys is same as sequence order.
+func sequenceKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
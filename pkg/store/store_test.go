@@ -0,0 +1,178 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge", "state.db")
+
+	s, err := New(path)
+	require.NoError(t, err)
+
+	_, err = s.Get("tokens", "col1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.Put("tokens", "col1", []byte("foo")))
+
+	v, err := s.Get("tokens", "col1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foo"), v)
+
+	require.NoError(t, s.Close())
+
+	s, err = New(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	v, err = s.Get("tokens", "col1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foo"), v)
+
+	require.NoError(t, s.Delete("tokens", "col1"))
+
+	_, err = s.Get("tokens", "col1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_StoreAppend(t *testing.T) {
+	bolt, err := New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = bolt.Close() })
+
+	tests := []struct {
+		Name  string
+		Store Store
+	}{
+		{Name: "bolt", Store: bolt},
+		{Name: "memory", Store: NewMemory()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := tt.Store
+
+			_, _, err := s.First("queue")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// more than 9 items to check keys are sorted by sequence
+			keys := make([]string, 0)
+			for i := 0; i < 8; i++ {
+				key, err := s.Append("queue", []byte{byte(i)})
+				require.NoError(t, err)
+				keys = append(keys, key)
+			}
+
+			appended, err := s.AppendAll("queue", [][]byte{{8}, {9}, {10}, {11}})
+			require.NoError(t, err)
+			keys = append(keys, appended...)
+
+			visited := make([]string, 0)
+			require.NoError(t, s.ForEach("queue", func(key string, _ []byte) error {
+				visited = append(visited, key)
+				return nil
+			}))
+			assert.Equal(t, keys, visited)
+
+			for i := 0; i < 12; i++ {
+				key, v, err := s.First("queue")
+				require.NoError(t, err)
+				assert.Equal(t, keys[i], key)
+				assert.Equal(t, []byte{byte(i)}, v)
+				require.NoError(t, s.Delete("queue", key))
+			}
+
+			_, _, err = s.First("queue")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func Test_StorePutOrder(t *testing.T) {
+	bolt, err := New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = bolt.Close() })
+
+	tests := []struct {
+		Name  string
+		Store Store
+	}{
+		{Name: "bolt", Store: bolt},
+		{Name: "memory", Store: NewMemory()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := tt.Store
+
+			for _, k := range []string{"c", "a", "d", "b", "a"} {
+				require.NoError(t, s.Put("bucket", k, []byte(k)))
+			}
+			require.NoError(t, s.Delete("bucket", "c"))
+			require.NoError(t, s.Delete("bucket", "e"))
+
+			visited := make([]string, 0)
+			require.NoError(t, s.ForEach("bucket", func(key string, _ []byte) error {
+				visited = append(visited, key)
+				return nil
+			}))
+			assert.Equal(t, []string{"a", "b", "d"}, visited)
+
+			key, v, err := s.First("bucket")
+			require.NoError(t, err)
+			assert.Equal(t, "a", key)
+			assert.Equal(t, []byte("a"), v)
+		})
+	}
+}
+
+func Test_StoreMove(t *testing.T) {
+	bolt, err := New(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = bolt.Close() })
+
+	tests := []struct {
+		Name  string
+		Store Store
+	}{
+		{Name: "bolt", Store: bolt},
+		{Name: "memory", Store: NewMemory()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := tt.Store
+
+			_, err := s.Move("dead", "missing", "queue", []byte("a"))
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			key, err := s.Append("dead", []byte("a"))
+			require.NoError(t, err)
+
+			moved, err := s.Move("dead", key, "queue", []byte("b"))
+			require.NoError(t, err)
+
+			_, err = s.Get("dead", key)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			v, err := s.Get("queue", moved)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("b"), v)
+
+			// moved key isn't moved again
+			_, err = s.Move("dead", key, "queue", []byte("b"))
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			visited := 0
+			require.NoError(t, s.ForEach("queue", func(string, []byte) error {
+				visited++
+				return nil
+			}))
+			assert.Equal(t, 1, visited)
+		})
+	}
+}
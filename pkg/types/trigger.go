@@ -1,6 +1,10 @@
 package types
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
 
 type TriggerOpType string
 
@@ -14,11 +18,37 @@ type TriggerRequestBody struct {
 	IndexUID string        `json:"index_uid"`
 	Type     TriggerOpType `json:"type"`
 	Document *Document     `json:"document"`
+	// Source is collection of index map, it's required if many sources feed index.
+	Source string `json:"source,omitempty"`
 }
 
+type TriggerStatus string
+
+const (
+	TriggerQueued  TriggerStatus = "queued"
+	TriggerInvalid TriggerStatus = "invalid"
+)
+
+// TriggerItemResult is result of item of batch trigger, Position is index of
+// item in request.
+type TriggerItemResult struct {
+	Position int           `json:"position"`
+	Status   TriggerStatus `json:"status"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type TriggerBatchResponse struct {
+	Results []TriggerItemResult `json:"results"`
+}
+
+// Document locates document in source by primary key, if Body is set the
+// document is pushed as is and source isn't read (push mode). Keys locates
+// document of index with key columns by all of them instead of primary key.
 type Document struct {
-	PrimaryKey   string `json:"primary_key"`
-	PrimaryValue any    `json:"primary_value"`
+	PrimaryKey   string         `json:"primary_key"`
+	PrimaryValue any            `json:"primary_value"`
+	Keys         map[string]any `json:"keys,omitempty"`
+	Body         map[string]any `json:"document,omitempty"`
 }
 
 func (t *TriggerRequestBody) Validate() error {
@@ -36,6 +66,20 @@ func (t *TriggerRequestBody) Validate() error {
 		return errors.New("document is empty")
 	}
 
+	if len(t.Document.Keys) > 0 {
+		for k, v := range t.Document.Keys {
+			if v == nil {
+				return fmt.Errorf("document key %s is empty", k)
+			}
+
+			if err := t.matchBody(k, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
 	if len(t.Document.PrimaryKey) == 0 {
 		return errors.New("document primary_key is empty")
 	}
@@ -44,5 +88,24 @@ func (t *TriggerRequestBody) Validate() error {
 		return errors.New("document primary_value is empty")
 	}
 
+	return t.matchBody(t.Document.PrimaryKey, t.Document.PrimaryValue)
+}
+
+// matchBody checks field of document body is same as key of document, so pushed
+// document doesn't replace other document of index.
+func (t *TriggerRequestBody) matchBody(field string, value any) error {
+	if t.Document.Body == nil || t.Type == DELETE {
+		return nil
+	}
+
+	v, ok := t.Document.Body[field]
+	if !ok {
+		return fmt.Errorf("document body has no %s field", field)
+	}
+
+	if !reflect.DeepEqual(v, value) {
+		return fmt.Errorf("document body %s field doesn't match document key", field)
+	}
+
 	return nil
 }
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerRequestBody_Validate(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Body     string
+		Excepted bool
+	}{
+		{
+			Name:     "push",
+			Body:     `{"index_uid":"foo","type":"UPDATE","document":{"primary_key":"id","primary_value":1,"document":{"id":1}}}`,
+			Excepted: true,
+		},
+		{
+			Name:     "push without primary key",
+			Body:     `{"index_uid":"foo","type":"UPDATE","document":{"primary_key":"id","primary_value":1,"document":{"name":"foo"}}}`,
+			Excepted: false,
+		},
+		{
+			Name:     "push other document",
+			Body:     `{"index_uid":"foo","type":"UPDATE","document":{"primary_key":"id","primary_value":1,"document":{"id":2}}}`,
+			Excepted: false,
+		},
+		{
+			Name:     "push other document of keys",
+			Body:     `{"index_uid":"foo","type":"INSERT","document":{"keys":{"tenant":1,"sku":"a"},"document":{"tenant":1,"sku":"b"}}}`,
+			Excepted: false,
+		},
+		{
+			Name:     "delete ignores document",
+			Body:     `{"index_uid":"foo","type":"DELETE","document":{"primary_key":"id","primary_value":1,"document":{"id":2}}}`,
+			Excepted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var b TriggerRequestBody
+			require.NoError(t, json.Unmarshal([]byte(tt.Body), &b))
+			assert.Equal(t, tt.Excepted, b.Validate() == nil)
+		})
+	}
+}